@@ -0,0 +1,192 @@
+package poloniex
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+)
+
+type (
+	//AccountManager holds the clients of several accounts by name, it routes orders to them and
+	//aggregates their balances, orders and trades, all of their REST calls share one rate limit
+	AccountManager struct {
+		mu       sync.RWMutex
+		accounts map[string]*Poloniex
+		// own holds the limiter each account's client had before it was added
+		own     map[string]*RateLimiter
+		limiter *RateLimiter
+	}
+)
+
+// NewAccountManager returns a manager whose accounts share a limit of perSecond REST calls,
+// DefaultRateLimit when perSecond isn't positive
+func NewAccountManager(perSecond int) *AccountManager {
+	if perSecond <= 0 {
+		perSecond = DefaultRateLimit
+	}
+	return &AccountManager{accounts: map[string]*Poloniex{}, own: map[string]*RateLimiter{}, limiter: NewRateLimiter(perSecond)}
+}
+
+// Add puts the client of an account under name, replacing any account of that name. The client's
+// own limiter, if any, is swapped for the shared one until the account is removed or replaced.
+func (m *AccountManager) Add(name string, p *Poloniex) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.accounts[name]; ok {
+		if old == p {
+			return
+		}
+		old.UseRateLimiter(m.own[name])
+	}
+	m.own[name] = p.limiter
+	p.UseRateLimiter(m.limiter)
+	m.accounts[name] = p
+}
+
+// Remove drops the account name, its client keeps working on its own with the limiter it had
+// before it was added
+func (m *AccountManager) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.accounts[name]; ok {
+		p.UseRateLimiter(m.own[name])
+	}
+	delete(m.accounts, name)
+	delete(m.own, name)
+}
+
+// Account returns the client of the account name
+func (m *AccountManager) Account(name string) (*Poloniex, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.accounts[name]
+	if !ok {
+		return nil, errors.New("no account " + name)
+	}
+	return p, nil
+}
+
+// Names returns the names of the accounts, sorted
+func (m *AccountManager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := []string{}
+	for name := range m.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// each calls f for every account in name order, stopping at the first error
+func (m *AccountManager) each(f func(name string, p *Poloniex) error) error {
+	for _, name := range m.Names() {
+		p, err := m.Account(name)
+		if err != nil {
+			// removed meanwhile
+			continue
+		}
+		if err := f(name, p); err != nil {
+			return errors.Wrap(err, "account "+name)
+		}
+	}
+	return nil
+}
+
+// Balances returns the balances of every account by account name
+func (m *AccountManager) Balances() (balances map[string]Balances, err error) {
+	balances = map[string]Balances{}
+	err = m.each(func(name string, p *Poloniex) error {
+		b, err := p.Balances()
+		balances[name] = b
+		return err
+	})
+	return
+}
+
+// TotalBalances returns the balances of all accounts added up by currency
+func (m *AccountManager) TotalBalances() (total Balances, err error) {
+	balances, err := m.Balances()
+	if err != nil {
+		return
+	}
+	sums := map[string][3]*big.Rat{}
+	for _, bb := range balances {
+		for c, b := range bb {
+			s, ok := sums[c]
+			if !ok {
+				s = [3]*big.Rat{new(big.Rat), new(big.Rat), new(big.Rat)}
+				sums[c] = s
+			}
+			s[0].Add(s[0], toRat(b.Available))
+			s[1].Add(s[1], toRat(b.OnOrders))
+			s[2].Add(s[2], toRat(b.BTCValue))
+		}
+	}
+	total = Balances{}
+	for c, s := range sums {
+		total[c] = Balance{Available: ratDecimal(s[0], 8), OnOrders: ratDecimal(s[1], 8), BTCValue: ratDecimal(s[2], 8)}
+	}
+	return
+}
+
+// OpenOrdersAll returns the open orders of every account by account name
+func (m *AccountManager) OpenOrdersAll() (openOrders map[string]OpenOrdersAll, err error) {
+	openOrders = map[string]OpenOrdersAll{}
+	err = m.each(func(name string, p *Poloniex) error {
+		o, err := p.OpenOrdersAll()
+		openOrders[name] = o
+		return err
+	})
+	return
+}
+
+// PrivateTradeHistoryAll returns the trade history of every account by account name
+func (m *AccountManager) PrivateTradeHistoryAll() (history map[string]PrivateTradeHistoryAll, err error) {
+	history = map[string]PrivateTradeHistoryAll{}
+	err = m.each(func(name string, p *Poloniex) error {
+		h, err := p.PrivateTradeHistoryAll()
+		history[name] = h
+		return err
+	})
+	return
+}
+
+// Buy places a limit buy order on the account name
+func (m *AccountManager) Buy(account, pair string, rate, amount ggm.Decimal) (buy Buy, err error) {
+	p, err := m.Account(account)
+	if err != nil {
+		return
+	}
+	return p.Buy(pair, rate, amount)
+}
+
+// Sell places a limit sell order on the account name
+func (m *AccountManager) Sell(account, pair string, rate, amount ggm.Decimal) (sell Sell, err error) {
+	p, err := m.Account(account)
+	if err != nil {
+		return
+	}
+	return p.Sell(pair, rate, amount)
+}
+
+// Move moves an order of the account name to rate
+func (m *AccountManager) Move(account string, orderNumber int64, rate ggm.Decimal) (moveOrder MoveOrder, err error) {
+	p, err := m.Account(account)
+	if err != nil {
+		return
+	}
+	return p.Move(orderNumber, rate)
+}
+
+// CancelOrder cancels an order of the account name
+func (m *AccountManager) CancelOrder(account string, orderNumber int64) (success bool, err error) {
+	p, err := m.Account(account)
+	if err != nil {
+		return
+	}
+	return p.CancelOrder(orderNumber)
+}
@@ -1,29 +1,68 @@
 package poloniex
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/franela/goreq"
+	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 
 	"gopkg.in/beatgammit/turnpike.v2"
 )
 
 type (
+	//Endpoints are the addresses the client talks to, empty fields mean the Poloniex defaults
+	Endpoints struct {
+		Public  string
+		Private string
+		WS      string
+		Push    string
+	}
+
 	//Poloniex describes the API
 	Poloniex struct {
 		Key          string
 		Secret       string
 		ws           *turnpike.Client
-		subscribedTo map[string]bool
-		debug        bool
+		connecting   chan struct{}
+		push         *websocket.Conn
+		pushHandlers map[int]*pushSubscription
+		lastPush     time.Time
+		pushSince    time.Time
+		heartbeat    chan struct{}
+		endpoints    Endpoints
+		cassette     *Cassette
+		cassetteMode int
+		replayTopics map[string]turnpike.EventHandler
+		topics       map[string]*wsTopic
+		legacy       map[string][]*Subscription
+		paper        *PaperTrading
+		credentials  CredentialsProvider
+		limiter      *RateLimiter
+		validator    *OrderValidator
+		guard        *WithdrawalGuard
+		claimed      map[int64]time.Time
+		middleware   []Middleware
+		metrics      Metrics
+		tracer       Tracer
+		logger       Logger
 		nonce        int64
 		mutex        sync.Mutex
+		wsMutex      sync.Mutex
+		paperMutex   sync.Mutex
+		credMutex    sync.RWMutex
+		claimMutex   sync.Mutex
 	}
 )
 
@@ -32,36 +71,236 @@ const (
 	PUBLICURI = "https://poloniex.com/public"
 	// PRIVATEURI is the address of the public API on Poloniex
 	PRIVATEURI = "https://poloniex.com/tradingApi"
+	// WSURI is the address of the WAMP websocket API on Poloniex
+	WSURI = "wss://api.poloniex.com"
 )
 
-func (p *Poloniex) InitWS() {
-	if p.ws != nil {
-		return
+// UseEndpoints points the client somewhere other than Poloniex, e.g. at a poloniextest.Server
+func (p *Poloniex) UseEndpoints(e Endpoints) {
+	p.endpoints = e
+}
+
+func (p *Poloniex) publicURI() string {
+	if p.endpoints.Public != "" {
+		return p.endpoints.Public
 	}
-	err := retry(100, 3*time.Second, func() error {
-		t := &tls.Config{InsecureSkipVerify: true}
-		u := "wss://api.poloniex.com"
-		c, err := turnpike.NewWebsocketClient(turnpike.JSON, u, t)
-		if err != nil {
-			log.Println(err)
-			return errors.Wrap(err, "open of websocket connection to "+u+" failed")
+	return PUBLICURI
+}
+
+func (p *Poloniex) privateURI() string {
+	if p.endpoints.Private != "" {
+		return p.endpoints.Private
+	}
+	return PRIVATEURI
+}
+
+func (p *Poloniex) wsURI() string {
+	if p.endpoints.WS != "" {
+		return p.endpoints.WS
+	}
+	return WSURI
+}
+
+func (p *Poloniex) pushURI() string {
+	if p.endpoints.Push != "" {
+		return p.endpoints.Push
+	}
+	return PUSHURI
+}
+
+// InitWS opens the WAMP websocket connection, see Connect
+func (p *Poloniex) InitWS() error {
+	return p.Connect(context.Background())
+}
+
+// Connect opens the WAMP websocket connection unless it is open already, retrying for up to
+// 100 attempts 3 seconds apart or until ctx is done. Concurrent callers share one attempt.
+func (p *Poloniex) Connect(ctx context.Context) (err error) {
+	p.wsMutex.Lock()
+	for p.ws == nil && p.connecting != nil {
+		wait := p.connecting
+		p.wsMutex.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		_, err = c.JoinRealm("realm1", nil)
+		p.wsMutex.Lock()
+	}
+	if p.ws != nil {
+		p.wsMutex.Unlock()
+		return nil
+	}
+	connecting := make(chan struct{})
+	p.connecting = connecting
+	p.wsMutex.Unlock()
+	defer func() {
+		p.wsMutex.Lock()
+		p.connecting = nil
+		p.wsMutex.Unlock()
+		close(connecting)
+	}()
+
+	ctx, span := p.trace().Start(ctx, "poloniex.connect", "poloniex.uri", p.wsURI())
+	attempts := 0
+	defer func() {
+		span.SetAttributes("poloniex.retries", attempts-1)
+		span.End(err)
+	}()
+	err = retry(ctx, p.log(), 100, 3*time.Second, func() error {
+		attempts++
+		c, err := p.dialWS()
 		if err != nil {
-			log.Println(err)
-			return errors.Wrap(err, "joining realm1 failed")
+			return err
 		}
+		p.wsMutex.Lock()
 		p.ws = c
+		p.wsMutex.Unlock()
 		return nil
 	})
+	return errors.Wrap(err, "connecting the websocket failed")
+}
+
+// dialWS opens a WAMP websocket connection and joins the realm
+func (p *Poloniex) dialWS() (*turnpike.Client, error) {
+	t := &tls.Config{InsecureSkipVerify: true}
+	u := p.wsURI()
+	c, err := turnpike.NewWebsocketClient(turnpike.JSON, u, t)
+	if err != nil {
+		return nil, errors.Wrap(err, "open of websocket connection to "+u+" failed")
+	}
+	if _, err := c.JoinRealm("realm1", nil); err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "joining realm1 failed")
+	}
+	return c, nil
+}
+
+// do performs a REST call through the middleware chain and returns the response body,
+// an error answer of Poloniex is returned as an *APIError
+func (p *Poloniex) do(ctx context.Context, kind, command string, params url.Values) (body string, err error) {
+	attrs := []interface{}{"poloniex.api", kind, "poloniex.command", command}
+	if pair := params.Get("currencyPair"); pair != "" {
+		attrs = append(attrs, "poloniex.pair", pair)
+	}
+	if n := params.Get("orderNumber"); n != "" {
+		attrs = append(attrs, "poloniex.order_number", n)
+	}
+	ctx, span := p.trace().Start(ctx, "poloniex."+command, attrs...)
+	defer func() { span.End(err) }()
+
+	h := p.send
+	for i := len(p.middleware) - 1; i >= 0; i-- {
+		h = p.middleware[i](h)
+	}
+	start := time.Now()
+	res, err := h(&Request{Context: ctx, Kind: kind, Command: command, Params: params, Headers: map[string]string{}})
+	if err == nil {
+		span.SetAttributes("http.status_code", res.Status)
+		err = apiError(command, res.Status, res.Body)
+	}
+	p.measure().ObserveRequest(kind, command, time.Since(start), errorLabel(err))
+	if err != nil {
+		return "", err
+	}
+	return res.Body, nil
+}
+
+// send is the end of the middleware chain, it signs private calls and sends them, or serves them
+// from the cassette being replayed
+func (p *Poloniex) send(r *Request) (*Response, error) {
+	kind, command, params := r.Kind, r.Command, r.Params
+	if err := r.Context.Err(); err != nil {
+		// a request can't be cancelled once sent, it is only given up before
+		return nil, err
+	}
+	if pt, ok := r.Context.Value(paperKey{}).(*PaperTrading); ok {
+		s, err := pt.serve(command, params)
+		if err != nil {
+			return nil, err
+		}
+		return &Response{Status: 200, Body: s}, nil
+	}
+	if p.cassetteMode == cassetteReplay {
+		p.log().Debug("replaying request", "kind", kind, "command", command)
+		i, err := p.cassette.response(kind, command, params)
+		if err != nil {
+			return nil, err
+		}
+		// replayed with its recorded status, so recorded errors fail the same way
+		status := i.Status
+		if status == 0 {
+			status = 200
+		}
+		return &Response{Status: status, Body: i.Response}, nil
+	}
+
+	headers := map[string]string{}
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+	req := goreq.Request{Uri: p.publicURI(), QueryString: params, Timeout: 130 * time.Second}
+	if kind == "private" {
+		postData := params.Encode()
+		req = goreq.Request{
+			Method:      "POST",
+			Uri:         p.privateURI(),
+			Body:        postData,
+			ContentType: "application/x-www-form-urlencoded",
+			Accept:      "application/json",
+			Timeout:     130 * time.Second,
+		}
+		key, secret := p.keys()
+		headers["Sign"] = sign(secret, postData)
+		headers["Key"] = key
+		headers["Content-Length"] = strconv.Itoa(len(postData))
+	}
+	for k, v := range headers {
+		req.AddHeader(k, v)
+	}
+
+	start := time.Now()
+	res, err := req.Do()
+	if err != nil {
+		p.log().Error("request failed", "kind", kind, "command", command, "latency", time.Since(start), "error", err)
+		if dialFailed(err) {
+			return nil, err
+		}
+		return nil, &sentError{err}
+	}
+	defer res.Body.Close()
+
+	s, err := res.Body.ToString()
 	if err != nil {
-		log.Fatalln(errors.Wrap(err, "retries exhausted, fatal."))
+		p.log().Error("reading response failed", "kind", kind, "command", command, "status", res.StatusCode, "error", err)
+		return nil, &sentError{err}
+	}
+	latency := time.Since(start)
+	p.log().Debug("request", "kind", kind, "command", command, "status", res.StatusCode, "latency", latency, "response", s)
+	if p.cassetteMode == cassetteRecord {
+		p.cassette.record(Interaction{
+			Kind:     kind,
+			Command:  command,
+			Params:   withoutNonce(params),
+			Headers:  redactHeaders(headers),
+			Status:   res.StatusCode,
+			Response: s,
+		})
 	}
-	p.subscribedTo = map[string]bool{}
+	return &Response{Status: res.StatusCode, Body: s, Latency: latency}, nil
+}
 
+// dialFailed reports whether err of a request is a failure to connect, the request never left then
+func dialFailed(err error) bool {
+	if e, ok := err.(*goreq.Error); ok {
+		// goreq keeps the error of the http client unwrapped
+		err = e.Err
+	}
+	op := (*net.OpError)(nil)
+	return errors.As(err, &op) && op.Op == "dial"
 }
 
-func retry(attempts int, sleep time.Duration, callback func() error) (err error) {
+func retry(ctx context.Context, logger Logger, attempts int, sleep time.Duration, callback func() error) (err error) {
 	for i := 0; ; i++ {
 		err = callback()
 		if err == nil {
@@ -72,20 +311,22 @@ func retry(attempts int, sleep time.Duration, callback func() error) (err error)
 			break
 		}
 
-		time.Sleep(sleep)
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return fmt.Errorf("%s after %d attempts, last error: %s", ctx.Err(), i+1, err)
+		}
 
-		log.Println("retrying after error:", err)
+		logger.Warn("retrying after error", "attempt", i+1, "error", err)
 	}
 	return fmt.Errorf("after %d attempts, last error: %s", attempts, err)
 }
 
-func (p *Poloniex) isSubscribed(code string) bool {
-	_, ok := p.subscribedTo[code]
-	return ok
-}
-
+// Debug logs everything the client does to the standard logger
+//
+// Deprecated: use SetLogger.
 func (p *Poloniex) Debug() {
-	p.debug = true
+	p.SetLogger(NewStdLogger(log.New(os.Stderr, "", log.LstdFlags)))
 }
 
 func (p *Poloniex) GetNonce() string {
@@ -103,20 +344,29 @@ func NewWithCredentials(key, secret string) *Poloniex {
 	return p
 }
 
-// NewWithConfig is the replacement function for New, pass in a configfile to use
-func NewWithConfig(configfile string) *Poloniex {
+// NewFromConfigFile creates a client with the key and secret of a JSON config file, see config-example.json
+func NewFromConfigFile(path string) (*Poloniex, error) {
 	p := map[string]string{}
-	// we have a configfile
-	b, err := ioutil.ReadFile(configfile)
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalln(errors.Wrap(err, "reading "+configfile+" failed."))
+		return nil, errors.Wrap(err, "reading "+path+" failed")
 	}
 	err = json.Unmarshal(b, &p)
 	if err != nil {
-		log.Fatalln(errors.Wrap(err, "unmarshal of config failed."))
+		return nil, errors.Wrap(err, "unmarshal of config failed")
 	}
-	return NewWithCredentials(p["key"], p["secret"])
+	return NewWithCredentials(p["key"], p["secret"]), nil
+}
 
+// NewWithConfig is the replacement function for New, pass in a configfile to use
+//
+// Deprecated: use NewFromConfigFile, NewWithConfig exits the program when the config can't be read.
+func NewWithConfig(configfile string) *Poloniex {
+	p, err := NewFromConfigFile(configfile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return p
 }
 
 // NewPublicOnly allows the use of the public and websocket api only
@@ -128,15 +378,8 @@ func NewPublicOnly() *Poloniex {
 }
 
 // New is the legacy way to create a new client, here just to maintain api
+//
+// Deprecated: use NewFromConfigFile, New exits the program when the config can't be read.
 func New(configfile string) *Poloniex {
 	return NewWithConfig(configfile)
 }
-
-func trace(s string) (string, time.Time) {
-	return s, time.Now()
-}
-
-func un(s string, startTime time.Time) {
-	elapsed := time.Since(startTime)
-	log.Printf("trace end: %s, elapsed %f secs\n", s, elapsed.Seconds())
-}
@@ -1,335 +1,2005 @@
 package poloniex
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"io/ioutil"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/k0kubun/pp"
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api/poloniextest"
 )
 
-var (
-	mutex sync.Mutex
-)
+func newTestClient(t *testing.T) (*Poloniex, *poloniextest.Server) {
+	srv := poloniextest.NewServer()
+	t.Cleanup(srv.Close)
+	p := NewWithCredentials(srv.Key, srv.Secret)
+	p.UseEndpoints(Endpoints{Public: srv.PublicURL, Private: srv.PrivateURL, WS: srv.WSURL, Push: srv.PushURL})
+	t.Cleanup(func() { p.Close() })
+
+	srv.SetTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0305, PercentChange: 0.0123, BaseVolume: 120, QuoteVolume: 3900})
+	srv.SetTicker("BTC_FCT", poloniextest.Ticker{Last: 0.0021, BaseVolume: 4, QuoteVolume: 1900})
+	srv.SetOrderBook("BTC_ETH",
+		[]poloniextest.Level{{Rate: 0.031, Amount: 10}, {Rate: 0.032, Amount: 20}},
+		[]poloniextest.Level{{Rate: 0.030, Amount: 10}, {Rate: 0.029, Amount: 20}})
+	srv.SetOrderBook("BTC_FCT",
+		[]poloniextest.Level{{Rate: 0.0022, Amount: 100}},
+		[]poloniextest.Level{{Rate: 0.0020, Amount: 100}})
+	srv.SetCurrency("BTC", poloniextest.Currency{ID: 28, Name: "Bitcoin", TxFee: 0.0005, MinConf: 1})
+	srv.SetCurrency("ETH", poloniextest.Currency{ID: 267, Name: "Ethereum", TxFee: 0.01, MinConf: 35})
+	srv.SetBalance("BTC", 1)
+	srv.SetBalance("ETH", 10)
+	return p, srv
+}
+
+func d(s string) ggm.Decimal {
+	v, err := ggm.NewDecimalFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func f(v ggm.Decimal) float64 {
+	x, _ := strconv.ParseFloat(v.String(), 64)
+	return x
+}
 
 func TestWSTicker(t *testing.T) {
-	p := New("config.json")
-	p.SubscribeTicker(tickerHandler)
-	time.Sleep(5 * time.Second)
-	p.UnsubscribeTicker()
+	p, srv := newTestClient(t)
+	sub, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.PublishTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0307, LowestAsk: 0.031, HighestBid: 0.030, PercentChange: 1.5})
+	select {
+	case tick := <-sub.C:
+		if tick.Pair != "BTC_ETH" || f(tick.Last) != 0.0307 || f(tick.PercentChange) != 1.5 {
+			t.Errorf("unexpected ticker %+v", tick)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ticker update")
+	}
+}
+
+func TestWSTickerSubscribers(t *testing.T) {
+	p, srv := newTestClient(t)
+	a, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-a.C; ok {
+		t.Error("closed subscription still delivers")
+	}
+	srv.PublishTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0307})
+	select {
+	case tick := <-b.C:
+		if tick.Pair != "BTC_ETH" {
+			t.Errorf("unexpected ticker %+v", tick)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing one subscriber stopped the other")
+	}
+}
+
+func TestWSSlowSubscriber(t *testing.T) {
+	p, srv := newTestClient(t)
+	slow, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	fast, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// slow never reads, fast still gets every update
+	for i := 0; i < 3; i++ {
+		srv.PublishTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0307})
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-fast.C:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d of 3 updates", i)
+		}
+	}
 }
 
 func TestWSTrades(t *testing.T) {
-	p := New("config.json")
-	p.SubscribeOrder("BTC_FCT", orderHandler)
-	time.Sleep(5 * time.Second)
-	p.UnsubscribeOrder("BTC_FCT")
+	p, srv := newTestClient(t)
+	sub, err := p.NewOrderSubscription("BTC_ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.PublishTrade("BTC_ETH", 42, poloniextest.Trade{ID: 7, Date: time.Now(), Type: "buy", Rate: 0.031, Amount: 2})
+	select {
+	case o := <-sub.C:
+		if o.Seq != 42 || len(o.Orders) != 1 || o.Orders[0].Type != "newTrade" || o.Orders[0].Data.TradeID != "7" {
+			t.Errorf("unexpected update %+v", o)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no trade update")
+	}
+}
+
+func TestWSAccountNotifications(t *testing.T) {
+	p, srv := newTestClient(t)
+	sub, err := p.NewAccountSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// give the subscription time to reach the server before pushing
+	time.Sleep(100 * time.Millisecond)
+	srv.Push(1000, "", []interface{}{
+		[]interface{}{"b", 28, "e", "-0.06000000"},
+		[]interface{}{"o", 12345, "0.00000000", "f"},
+	})
+	select {
+	case n := <-sub.C:
+		if len(n.Events) != 2 || n.Events[0].Balance == nil || n.Events[1].OrderUpdate == nil {
+			t.Fatalf("unexpected notification %+v", n)
+		}
+		if n.Events[0].Balance.CurrencyID != 28 || f(n.Events[0].Balance.Amount) != -0.06 {
+			t.Errorf("unexpected balance update %+v", n.Events[0].Balance)
+		}
+		if n.Events[1].OrderUpdate.OrderNumber != 12345 || n.Events[1].OrderUpdate.Reason != "f" {
+			t.Errorf("unexpected order update %+v", n.Events[1].OrderUpdate)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no account notification")
+	}
+}
+
+func TestWSDailyVolume(t *testing.T) {
+	p, srv := newTestClient(t)
+	sub, err := p.NewDailyVolumeSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	srv.Push(1003, nil, []interface{}{"2018-11-07 16:26", 5804, map[string]interface{}{"BTC": "3418.409", "USDT": "26112283.928"}})
+	select {
+	case v := <-sub.C:
+		if len(v) != 1 || f(v[DailyVolumeTotal]["BTC"]) != 3418.409 || f(v[DailyVolumeTotal]["USDT"]) != 26112283.928 {
+			t.Errorf("unexpected volume %+v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no volume")
+	}
+}
+
+func TestMonitorHeartbeat(t *testing.T) {
+	p, srv := newTestClient(t)
+	sub, err := p.NewDailyVolumeSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.LastMessageAge(); ok {
+		t.Error("message age before any message")
+	}
+	time.Sleep(100 * time.Millisecond)
+	srv.Heartbeat()
+	for i := 0; i < 100; i++ {
+		if _, ok := p.LastMessageAge(); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if age, ok := p.LastMessageAge(); !ok || age > time.Second {
+		t.Errorf("heartbeat not seen, age %v %v", age, ok)
+	}
+
+	p.MonitorHeartbeat(200 * time.Millisecond)
+	srv.DropPushConnections()
+	// the monitor notices the silence, reconnects and subscribes the channel again
+	deadline := time.After(5 * time.Second)
+	for {
+		srv.Push(1003, nil, []interface{}{"2018-11-07 16:26", 5804, map[string]interface{}{"BTC": "1"}})
+		select {
+		case <-sub.C:
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("push not reconnected")
+		}
+	}
+}
+
+func TestMonitorHeartbeatWAMP(t *testing.T) {
+	p, srv := newTestClient(t)
+	sub, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a timeout of zero is the default, not a panic
+	p.MonitorHeartbeat(0)
+	p.Close()
+	p, srv = newTestClient(t)
+	if sub, err = p.NewTickerSubscription(); err != nil {
+		t.Fatal(err)
+	}
+	m := &reconnectMetrics{}
+	p.SetMetrics(m)
+	p.MonitorHeartbeat(20 * time.Millisecond)
+	p.wsMutex.Lock()
+	old := p.ws
+	p.wsMutex.Unlock()
+	go func() { old.ReceiveDone <- true }()
+	for i := 0; i < 200; i++ {
+		p.wsMutex.Lock()
+		current := p.ws
+		p.wsMutex.Unlock()
+		if current != old {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	srv.PublishTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0307})
+	select {
+	case tick := <-sub.C:
+		if tick.Pair != "BTC_ETH" {
+			t.Errorf("unexpected ticker %+v", tick)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ticker not subscribed again after the connection dropped")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.feeds) != 1 || m.feeds[0] != "wamp" {
+		t.Errorf("unexpected reconnects %v", m.feeds)
+	}
+}
+
+type reconnectMetrics struct {
+	nopMetrics
+	mu    sync.Mutex
+	feeds []string
+}
+
+func (m *reconnectMetrics) ObserveReconnect(feed string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.feeds = append(m.feeds, feed)
+}
+
+func TestSubscribeAfterClose(t *testing.T) {
+	p, _ := newTestClient(t)
+	// Close runs between connecting and registering the subscription
+	wamp, err := p.wampTopic(context.Background(), "ticker", func([]interface{}, map[string]interface{}) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	push, err := p.pushChannel(AccountNotificationsChannel, true, func([]interface{}) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	for _, topic := range []*wsTopic{wamp, push} {
+		s := p.newSubscription("after close", func(interface{}, chan struct{}) {}, func() {})
+		if err := p.addSubscription(s, topic); err == nil {
+			t.Errorf("subscribed to %s after Close", topic.feed)
+		}
+		s.discard()
+	}
 }
 
-func TestWSTrollbox(t *testing.T) {
-	p := New("config.json")
-	p.SubscribeTrollbox(trollboxHandler)
-	time.Sleep(30 * time.Second)
-	p.UnsubscribeTrollbox()
+func TestClose(t *testing.T) {
+	p, _ := newTestClient(t)
+	sub, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := p.SubscribeOrder("BTC_ETH")
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("ticker channel not closed")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("order channel not closed")
+	}
 }
 
 func TestTicker(t *testing.T) {
-	p := New("config.json")
+	p, _ := newTestClient(t)
 	c, err := p.Ticker()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	e, ok := c["BTC_ETH"]
+	if !ok {
+		t.Fatal("BTC_ETH missing from ticker")
+	}
+	if f(e.Last) != 0.0305 || f(e.Ask) != 0.031 || f(e.Bid) != 0.030 {
+		t.Errorf("unexpected ticker %+v", e)
 	}
-	pp.Println(c)
 }
 
 func TestDailyVolume(t *testing.T) {
-	p := New("config.json")
+	p, _ := newTestClient(t)
 	c, err := p.DailyVolume()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if f(c["BTC_ETH"]["ETH"]) != 3900 {
+		t.Errorf("unexpected volume %+v", c["BTC_ETH"])
 	}
-	pp.Println(c)
 }
 
 func TestOrderBook(t *testing.T) {
-	p := New("config.json")
-	c, err := p.OrderBook("BTC_FCT")
+	p, srv := newTestClient(t)
+	c, err := p.OrderBook("BTC_ETH")
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
 	}
-	fmt.Println("ASKS")
-	for k, v := range c.Asks {
-		fmt.Println(k, v)
+	if len(c.Asks) != 2 || len(c.Bids) != 2 || f(c.Asks[0].Rate) != 0.031 || f(c.Bids[0].Rate) != 0.030 {
+		t.Errorf("unexpected book %+v", c)
 	}
-	fmt.Println("\nBIDS")
-	for k, v := range c.Bids {
-		fmt.Println(k, v)
+	if c.IsFrozen {
+		t.Error("book is frozen")
+	}
+	srv.SetFrozen("BTC_ETH", true)
+	c, err = p.OrderBook("BTC_ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsFrozen {
+		t.Error("book isn't frozen")
 	}
-
-	fmt.Println("IsFrozen?", c.IsFrozen)
 }
 
 func TestOrderBookAll(t *testing.T) {
-	p := New("config.json")
+	p, _ := newTestClient(t)
 	c, err := p.OrderBookAll()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
 	}
-	for k, v := range c {
-		fmt.Println("ASKS")
-		for kk, vv := range v.Asks {
-			fmt.Println(kk, vv)
-		}
-		fmt.Println("\nBIDS")
-		for kk, vv := range v.Bids {
-			fmt.Println(kk, vv)
-		}
-
-		fmt.Println(k, ": IsFrozen?", v.IsFrozen)
+	if len(c) != 2 || len(c["BTC_FCT"].Asks) != 1 {
+		t.Errorf("unexpected books %+v", c)
 	}
 }
 
 func TestTradeHistory(t *testing.T) {
-	p := New("config.json")
+	p, srv := newTestClient(t)
+	srv.SetTradeHistory("BTC_FCT", []poloniextest.Trade{{ID: 2, Date: time.Now(), Type: "sell", Rate: 0.002, Amount: 5}})
 	c, err := p.TradeHistory("BTC_FCT")
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if len(c) != 1 || c[0].ID != 2 || f(c[0].Total) != 0.01 {
+		t.Errorf("unexpected history %+v", c)
 	}
-	pp.Println(c)
 }
 
 func TestChartData(t *testing.T) {
-	p := New("config.json")
+	p, srv := newTestClient(t)
+	now := time.Now().Truncate(5 * time.Minute)
+	srv.SetChartData("BTC_FCT", []poloniextest.Candle{
+		{Date: now.Add(-48 * time.Hour), Close: 0.001},
+		{Date: now.Add(-5 * time.Minute), High: 0.0022, Low: 0.002, Open: 0.002, Close: 0.0021},
+	})
 	c, err := p.ChartData("BTC_FCT")
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if len(c) != 1 || f(c[0].Close) != 0.0021 {
+		t.Errorf("unexpected chart data %+v", c)
 	}
-	pp.Println(c)
 }
 
 func TestCurrencies(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
+	p, _ := newTestClient(t)
 	c, err := p.Currencies()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if c["BTC"].ID != 28 || c["BTC"].Name != "Bitcoin" || f(c["BTC"].TxFee) != 0.0005 {
+		t.Errorf("unexpected currencies %+v", c)
 	}
-	pp.Println(c)
 }
 
 func TestLoanOrders(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	c, err := p.LoanOrders("BTC")
-	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+	p, _ := newTestClient(t)
+	if _, err := p.LoanOrders("BTC"); err != nil {
+		t.Fatal(err)
 	}
-	pp.Println(c)
 }
 
 func TestBalances(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
+	p, _ := newTestClient(t)
 	c, err := p.Balances()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if f(c["BTC"].Available) != 1 || f(c["ETH"].Available) != 10 {
+		t.Errorf("unexpected balances %+v", c)
 	}
-	pp.Println(c)
 }
 
 func TestAddresses(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
+	p, _ := newTestClient(t)
+	if _, err := p.GenerateNewAddress("BTC"); err != nil {
+		t.Fatal(err)
+	}
 	c, err := p.Addresses()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if c["BTC"] == "" {
+		t.Errorf("unexpected addresses %+v", c)
 	}
-	pp.Println(c)
 }
 
 func TestGenerateNewAddress(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
+	p, _ := newTestClient(t)
 	c, err := p.GenerateNewAddress("BTS")
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if c == "" {
+		t.Error("no address generated")
 	}
-	pp.Println(c)
 }
 
 func TestDepositsWithdrawals(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	c, err := p.DepositsWithdrawals()
+	p, _ := newTestClient(t)
+	if _, err := p.DepositsWithdrawals(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDepositsWithdrawalsRange(t *testing.T) {
+	p, srv := newTestClient(t)
+	srv.Deposit("BTC", "poloniextest-btc-1", 0.5, time.Now().Add(-300*24*time.Hour))
+	srv.Deposit("BTC", "poloniextest-btc-1", 0.2, time.Now().Add(-time.Hour))
+	dw, err := p.DepositsWithdrawals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dw.Deposits) != 1 || f(dw.Deposits[0].Amount) != 0.2 {
+		t.Errorf("unexpected deposits %+v", dw.Deposits)
+	}
+	dw, err = p.DepositsWithdrawalsRange(time.Now().Add(-400*24*time.Hour), time.Now().Add(-200*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dw.Deposits) != 1 || f(dw.Deposits[0].Amount) != 0.5 {
+		t.Errorf("unexpected deposits %+v", dw.Deposits)
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	p, srv := newTestClient(t)
+	w, err := p.WithdrawPaymentID("ETH", d("2"), "0xabc", "memo-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.WithdrawalNumber == 0 || w.Response == "" {
+		t.Errorf("unexpected withdrawal %+v", w)
+	}
+	if sent := srv.Withdrawals(); len(sent) != 1 || sent[0].PaymentID != "memo-1" || sent[0].Amount != 2 {
+		t.Errorf("unexpected withdrawals %+v", sent)
+	}
+	dw, err := p.DepositsWithdrawals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dw.Withdrawals) != 1 || dw.Withdrawals[0].WithdrawalNumber != w.WithdrawalNumber {
+		t.Errorf("unexpected history %+v", dw.Withdrawals)
+	}
+
+	// an identical withdrawal doesn't get the number handed out already
+	again, err := p.WithdrawPaymentID("ETH", d("2"), "0xabc", "memo-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.WithdrawalNumber == 0 || again.WithdrawalNumber == w.WithdrawalNumber || again.LookupError != nil {
+		t.Errorf("unexpected withdrawal %+v after %+v", again, w)
+	}
+
+	// the withdrawal went through even if its number can't be looked up
+	p.Use(func(next Handler) Handler {
+		return func(r *Request) (*Response, error) {
+			if r.Command == "returnDepositsWithdrawals" {
+				return &Response{Status: 500, Body: "<html>Internal Server Error</html>"}, nil
+			}
+			return next(r)
+		}
+	})
+	w, err = p.Withdraw("ETH", d("1"), "0xabc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.WithdrawalNumber != 0 || !errors.Is(w.LookupError, &APIError{Kind: ErrorServer}) {
+		t.Errorf("failed lookup not reported %+v", w)
+	}
+	if sent := srv.Withdrawals(); len(sent) != 3 {
+		t.Errorf("unexpected withdrawals %+v", sent)
+	}
+}
+
+func TestWithdrawalGuard(t *testing.T) {
+	p, srv := newTestClient(t)
+	p.UseWithdrawalGuard(&WithdrawalGuard{
+		Addresses: map[string][]WhitelistedAddress{
+			"ETH": {{Address: "0xabc"}},
+			"XRP": {{Address: "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh", PaymentID: "104"}},
+		},
+		MaxAmount:  map[string]ggm.Decimal{"ETH": d("3")},
+		DailyLimit: map[string]ggm.Decimal{"ETH": d("5")},
+	})
+	refused := func(err error) bool {
+		_, ok := err.(*WithdrawalError)
+		return ok
+	}
+	if _, err := p.Withdraw("ETH", d("1"), "0xdef"); !refused(err) {
+		t.Errorf("withdrawal to an unlisted address not refused: %v", err)
+	}
+	if _, err := p.Withdraw("BTC", d("0.1"), "0xabc"); !refused(err) {
+		t.Errorf("withdrawal of an unlisted currency not refused: %v", err)
+	}
+	if _, err := p.Withdraw("ETH", d("4"), "0xabc"); !refused(err) {
+		t.Errorf("withdrawal above the maximum not refused: %v", err)
+	}
+	if _, err := p.Withdraw("ETH", d("3"), "0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Withdraw("ETH", d("3"), "0xabc"); !refused(err) {
+		t.Errorf("withdrawal above the daily limit not refused: %v", err)
+	}
+	// refused by the exchange, so it doesn't use up the daily limit
+	srv.SetBalance("ETH", 1)
+	if _, err := p.Withdraw("ETH", d("2"), "0xabc"); err == nil || refused(err) {
+		t.Errorf("withdrawal above the balance sent: %v", err)
+	}
+	srv.SetBalance("ETH", 10)
+	if _, err := p.Withdraw("ETH", d("2"), "0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := srv.Withdrawals(); len(sent) != 2 {
+		t.Errorf("unexpected withdrawals %+v", sent)
+	}
+
+	// the payment ID is part of the whitelisted address
+	srv.SetBalance("XRP", 100)
+	if _, err := p.WithdrawPaymentID("XRP", d("1"), "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh", "105"); !refused(err) {
+		t.Errorf("withdrawal with another payment ID not refused: %v", err)
+	}
+	if _, err := p.Withdraw("XRP", d("1"), "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh"); !refused(err) {
+		t.Errorf("withdrawal without payment ID not refused: %v", err)
+	}
+	if _, err := p.WithdrawPaymentID("XRP", d("1"), "rEb8TK3gBgk5auZkwc6sHnwrGVJH8DuaLh", "104"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithdrawalGuardUnsent(t *testing.T) {
+	p, srv := newTestClient(t)
+	p.UseWithdrawalGuard(&WithdrawalGuard{DailyLimit: map[string]ggm.Decimal{"ETH": d("3")}})
+
+	// given up before it was sent, it doesn't use up the daily limit
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.WithdrawContext(ctx, "ETH", d("3"), "0xabc"); !errors.Is(err, context.Canceled) {
+		t.Errorf("withdrawal with a cancelled context not given up: %v", err)
+	}
+	p.UseEndpoints(Endpoints{Private: "http://127.0.0.1:1"})
+	if _, err := p.Withdraw("ETH", d("3"), "0xabc"); err == nil {
+		t.Error("withdrawal sent without a connection")
+	}
+	p.UseEndpoints(Endpoints{Public: srv.PublicURL, Private: srv.PrivateURL, WS: srv.WSURL, Push: srv.PushURL})
+
+	// it may have gone through when the response is lost, so it keeps counting
+	p.Use(func(next Handler) Handler {
+		return func(r *Request) (*Response, error) {
+			if r.Command == "withdraw" && r.Params.Get("amount") == "2" {
+				return nil, &sentError{errors.New("read: connection reset by peer")}
+			}
+			return next(r)
+		}
+	})
+	if _, err := p.Withdraw("ETH", d("2"), "0xabc"); err == nil {
+		t.Fatal("lost response not reported")
+	}
+	if _, err := p.Withdraw("ETH", d("1.5"), "0xabc"); err == nil {
+		t.Error("withdrawal above the daily limit sent after a lost response")
+	}
+	if _, err := p.Withdraw("ETH", d("1"), "0xabc"); err != nil {
+		t.Fatal(err)
+	}
+	if sent := srv.Withdrawals(); len(sent) != 1 {
+		t.Errorf("unexpected withdrawals %+v", sent)
+	}
+}
+
+func TestBuySell(t *testing.T) {
+	p, _ := newTestClient(t)
+	// crosses the best ask of 10 ETH at 0.031, the rest of the order rests on the book
+	b, err := p.Buy("BTC_ETH", d("0.031"), d("12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.OrderNumber == 0 {
+		t.Fatal("no order number")
+	}
+	c, err := p.OpenOrders("BTC_ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 1 || c[0].OrderNumber != b.OrderNumber || f(c[0].Amount) != 2 {
+		t.Fatalf("unexpected open orders %+v", c)
+	}
+	s, err := p.Sell("BTC_ETH", d("0.035"), d("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := p.OpenOrdersAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all["BTC_ETH"]) != 2 || len(all["BTC_FCT"]) != 0 {
+		t.Errorf("unexpected open orders %+v", all)
+	}
+	ok, err := p.CancelOrder(s.OrderNumber)
+	if err != nil || !ok {
+		t.Fatal("cancel failed", err)
+	}
+	h, err := p.PrivateTradeHistory("BTC_ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 1 || f(h[0].Amount) != 10 || h[0].OrderNumber != b.OrderNumber {
+		t.Errorf("unexpected trade history %+v", h)
+	}
+	ot, err := p.OrderTrades(b.OrderNumber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ot) != 1 || f(ot[0].Fee) != 0.025 {
+		t.Errorf("unexpected order trades %+v", ot)
+	}
+}
+
+func TestMove(t *testing.T) {
+	p, _ := newTestClient(t)
+	b, err := p.Buy("BTC_ETH", d("0.025"), d("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := p.Move(b.OrderNumber, d("0.026"))
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if m.Success != 1 || m.OrderNumber == b.OrderNumber {
+		t.Errorf("unexpected move %+v", m)
 	}
-	pp.Println(c)
 }
 
 func TestOpenOrders(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
+	p, _ := newTestClient(t)
 	c, err := p.OpenOrders("BTC_FCT")
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if len(c) != 0 {
+		t.Errorf("unexpected open orders %+v", c)
 	}
-	pp.Println(c)
 }
 
 func TestOpenOrdersAll(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	c, err := p.OpenOrdersAll()
-	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+	p, _ := newTestClient(t)
+	if _, err := p.OpenOrdersAll(); err != nil {
+		t.Fatal(err)
 	}
-	pp.Println(c)
 }
 
 func TestPrivateTradeHistory(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	c, err := p.PrivateTradeHistory("BTC_FCT")
+	p, _ := newTestClient(t)
+	if _, err := p.PrivateTradeHistory("BTC_FCT"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrivateTradeHistoryAll(t *testing.T) {
+	p, srv := newTestClient(t)
+	srv.SetBalance("FCT", 10)
+	if _, err := p.Sell("BTC_FCT", d("0.002"), d("1")); err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.PrivateTradeHistoryAll()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if len(c["BTC_FCT"]) != 1 {
+		t.Errorf("unexpected trade history %+v", c)
 	}
-	pp.Println(c)
 }
 
-func TestLoanOffer(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	//currency string, amount float64, duration int, renew bool, lendingRate float64
-	c, err := p.LoanOffer("DASH", 0.00117188, 2, false, 0.0599)
+func TestFeeInfo(t *testing.T) {
+	p, srv := newTestClient(t)
+	srv.SetFees(0.001, 0.002)
+	c, err := p.FeeInfo()
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if f(c.MakerFee) != 0.001 || f(c.TakerFee) != 0.002 {
+		t.Errorf("unexpected fees %+v", c)
 	}
-	pp.Println(c)
 }
 
-func TestPrivateTradeHistoryAll(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	c, err := p.PrivateTradeHistoryAll()
+func TestInvalidCredentials(t *testing.T) {
+	p, srv := newTestClient(t)
+	p.Secret = "wrong"
+	srv.SetBalance("BTC", 1)
+	ok, _ := p.CancelOrder(1)
+	if ok {
+		t.Error("request signed with the wrong secret was accepted")
+	}
+}
+
+func TestLoanOffer(t *testing.T) {
+	p, _ := newTestClient(t)
+	c, err := p.LoanOffer("DASH", d("0.00117188"), 2, false, d("0.0599"))
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if c.OrderID == 0 {
+		t.Errorf("unexpected loan offer %+v", c)
 	}
-	pp.Println(c)
 }
 
 func TestOpenLoanOffers(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	c, err := p.OpenLoanOffers()
-	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+	p, _ := newTestClient(t)
+	if _, err := p.OpenLoanOffers(); err != nil {
+		t.Fatal(err)
 	}
-	pp.Println(c)
 }
 
 func TestToggleAutoRenew(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
+	p, _ := newTestClient(t)
 	c, err := p.ToggleAutoRenew(13181666)
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if !c {
+		t.Error("toggle failed")
 	}
-	pp.Println(c)
 }
+
 func TestActiveLoans(t *testing.T) {
-	p := New("config.json")
-	p.Debug()
-	c, err := p.ActiveLoans()
+	p, _ := newTestClient(t)
+	if _, err := p.ActiveLoans(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayOrderBook(t *testing.T) {
+	c, err := LoadCassette("testdata/orderbook.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewWithCredentials("key", "secret")
+	p.Replay(c)
+
+	ob, err := p.OrderBook("BTC_ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ob.IsFrozen || len(ob.Asks) != 2 || f(ob.Asks[1].Amount) != 20.5 {
+		t.Errorf("unexpected book %+v", ob)
+	}
+	// the exchange has sent isFrozen as a number as well as a string
+	ob, err = p.OrderBook("BTC_ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ob.IsFrozen || len(ob.Bids) != 0 {
+		t.Errorf("unexpected book %+v", ob)
+	}
+	if _, err := p.OrderBook("BTC_ETH"); err == nil {
+		t.Error("call served without a recorded interaction")
+	}
+
+	oo, err := p.OpenOrders("BTC_ETH")
 	if err != nil {
-		t.Fail()
-		log.Println(err)
-		return
+		t.Fatal(err)
+	}
+	if len(oo) != 1 || oo[0].OrderNumber != 120466 {
+		t.Errorf("unexpected open orders %+v", oo)
 	}
-	pp.Println(c)
 }
 
-func tickerHandler(p []interface{}, n map[string]interface{}) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	t := WSTicker{
-		Pair:          p[0].(string),
-		Last:          f(p[1]),
-		Ask:           f(p[2]),
-		Bid:           f(p[3]),
-		PercentChange: f(p[4]) * 100.0,
-		BaseVolume:    f(p[5]),
-		QuoteVolume:   f(p[6]),
-		IsFrozen:      p[7].(float64) != 0.0,
-		DailyHigh:     f(p[8]),
-		DailyLow:      f(p[9]),
+func TestReplayStatus(t *testing.T) {
+	c := &Cassette{Interactions: []Interaction{{
+		Kind:     "public",
+		Command:  "returnTicker",
+		Params:   url.Values{"command": {"returnTicker"}},
+		Status:   502,
+		Response: "<html>Bad Gateway</html>",
+	}}}
+	p := NewPublicOnly()
+	p.Replay(c)
+	var apiErr *APIError
+	if _, err := p.Ticker(); !errors.As(err, &apiErr) || apiErr.Status != 502 || apiErr.Kind != ErrorServer {
+		t.Errorf("recorded 502 not replayed as one: %v", err)
 	}
-	pp.Println(t)
 }
 
-func orderHandler(p []interface{}, n map[string]interface{}) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	for k := range p {
-		v := p[k].(map[string]interface{})
-		if v["type"].(string) == "newTrade" {
-			pp.Println("NEWTRADE", v["data"])
-		} else if v["type"].(string) == "orderBookModify" {
-			pp.Println("ORDERBOOKMODIFY", v["data"])
-		} else if v["type"].(string) == "orderBookRemove" {
-			pp.Println("ORDERBOOKREMOVE", v["data"])
-		} else {
-			pp.Println(v)
-		}
+func TestReplayFrames(t *testing.T) {
+	c, err := LoadCassette("testdata/orderbook.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewWithCredentials("key", "secret")
+	p.Replay(c)
+	ticker, err := p.NewTickerSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := p.NewAccountSubscription()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.PlayFrames()
+	if tick := <-ticker.C; tick.Pair != "BTC_ETH" || f(tick.Last) != 0.0307 {
+		t.Errorf("unexpected ticker %+v", tick)
+	}
+	if n := <-account.C; len(n.Events) != 1 || n.Events[0].Balance == nil {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	p, _ := newTestClient(t)
+	c := &Cassette{}
+	p.Record(c)
+	if _, err := p.Balances(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.OrderBook("BTC_ETH"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Interactions) != 2 {
+		t.Fatalf("unexpected interactions %+v", c.Interactions)
+	}
+	i := c.Interactions[0]
+	if i.Kind != "private" || i.Headers["Key"] != "REDACTED" || i.Headers["Sign"] != "REDACTED" || i.Params.Get("nonce") != "" {
+		t.Errorf("secrets recorded %+v", i)
+	}
+
+	r := NewWithCredentials("key", "secret")
+	r.Replay(c)
+	b, err := r.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f(b["BTC"].Available) != 1 {
+		t.Errorf("unexpected replayed balances %+v", b)
 	}
 }
 
-func trollboxHandler(p []interface{}, n map[string]interface{}) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	pp.Println(p)
+func TestPaperTrade(t *testing.T) {
+	p, srv := newTestClient(t)
+	pt, err := p.PaperTrade(map[string]ggm.Decimal{"BTC": d("1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// crosses the live best ask of 10 ETH at 0.031, the rest of the order rests on the simulated book
+	b, err := p.Buy("BTC_ETH", d("0.031"), d("12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bal, err := p.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f(bal["ETH"].Available) != 9.975 || f(bal["BTC"].OnOrders) != 0.062 {
+		t.Errorf("unexpected paper balances %+v", bal)
+	}
+
+	// a live sell at the rate of the resting order fills it
+	srv.PublishTrade("BTC_ETH", 1, poloniextest.Trade{ID: 9, Date: time.Now(), Type: "sell", Rate: 0.031, Amount: 5})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		o, err := p.OpenOrders("BTC_ETH")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(o) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("order %d not filled by the live trade, open orders %+v", b.OrderNumber, o)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pt.Stop()
+	bal, err = p.Balances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f(bal["BTC"].Available) != 1 || f(bal["ETH"].Available) != 10 {
+		t.Errorf("real balances changed by paper trading %+v", bal)
+	}
 }
 
-func init() {
-	mutex = sync.Mutex{}
+func TestPaperTradeMiddleware(t *testing.T) {
+	p, _ := newTestClient(t)
+	var mu sync.Mutex
+	seen := []string{}
+	p.Use(func(next Handler) Handler {
+		return func(r *Request) (*Response, error) {
+			mu.Lock()
+			seen = append(seen, r.Kind+" "+r.Command)
+			mu.Unlock()
+			return next(r)
+		}
+	})
+	pt, err := p.PaperTrade(map[string]ggm.Decimal{"BTC": d("1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// switching paper trading while calls are in flight
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			p.Balances()
+		}
+	}()
+	if _, err := p.Balances(); err != nil {
+		t.Fatal(err)
+	}
+	pt.Stop()
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) < 21 || seen[len(seen)-1] != "private returnCompleteBalances" {
+		t.Errorf("paper calls skipped the middleware %v", seen)
+	}
+}
+
+func TestNewFromConfigFile(t *testing.T) {
+	if _, err := NewFromConfigFile("testdata/missing.json"); err == nil {
+		t.Error("missing config accepted")
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"key": "k", "secret": "s"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewFromConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Key != "k" || p.Secret != "s" {
+		t.Errorf("unexpected credentials %q %q", p.Key, p.Secret)
+	}
+}
+
+func TestConnectGivesUp(t *testing.T) {
+	p := NewPublicOnly()
+	p.UseEndpoints(Endpoints{WS: "ws://127.0.0.1:1"})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := p.Connect(ctx); err == nil {
+		t.Fatal("connected to nothing")
+	}
+}
+
+func TestConnectConcurrent(t *testing.T) {
+	p, _ := newTestClient(t)
+	var wg sync.WaitGroup
+	conns := make(chan *Subscription, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := p.NewTickerSubscription()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns <- s.Subscription
+		}()
+	}
+	wg.Wait()
+	close(conns)
+	for s := range conns {
+		s.Close()
+	}
+}
+
+func TestCredentialsProviders(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Setenv("TEST_KEY", "env-key")
+	t.Setenv("TEST_SECRET", "env-secret")
+	providers := map[string]CredentialsProvider{
+		"env":         EnvCredentials("TEST_KEY", "TEST_SECRET"),
+		"json":        FileCredentials(write("c.json", `{"key": "k", "secret": "s"}`, 0600)),
+		"yaml":        FileCredentials(write("c.yaml", "key: k\nsecret: s\n", 0600)),
+		"yml":         FileCredentials(write("c.yml", "# rotated monthly\nkey: \"k\"\nsecret: s\n", 0600)),
+		"secret file": SecretFileCredentials(write("key", "k\n", 0400), write("secret", "s\n", 0400)),
+		"func":        CredentialsFunc(func() (Credentials, error) { return Credentials{"k", "s"}, nil }),
+	}
+	for name, cp := range providers {
+		c, err := cp.Credentials()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if c.Key == "" || c.Secret == "" || (name != "env" && c != (Credentials{"k", "s"})) {
+			t.Errorf("%s: unexpected credentials %+v", name, c)
+		}
+	}
+
+	if runtime.GOOS != "windows" {
+		if _, err := FileCredentials(write("open.json", `{"key": "k", "secret": "s"}`, 0644)).Credentials(); err == nil {
+			t.Error("credentials readable by others accepted")
+		}
+	}
+	if _, err := EnvCredentials("TEST_UNSET_KEY", "").Credentials(); err == nil {
+		t.Error("unset environment accepted")
+	}
+}
+
+func TestRefreshCredentials(t *testing.T) {
+	_, srv := newTestClient(t)
+	current := Credentials{"old", "old"}
+	p, err := NewWithCredentialsProvider(CredentialsFunc(func() (Credentials, error) { return current, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.UseEndpoints(Endpoints{Public: srv.PublicURL, Private: srv.PrivateURL})
+	if b, _ := p.Buy("BTC_ETH", d("0.02"), d("1")); b.OrderNumber != 0 {
+		t.Fatal("stale credentials accepted")
+	}
+	current = Credentials{srv.Key, srv.Secret}
+	if err := p.RefreshCredentials(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := p.Buy("BTC_ETH", d("0.02"), d("1")); err != nil || b.OrderNumber == 0 {
+		t.Fatal("refreshed credentials rejected", err)
+	}
+}
+
+func TestSetCredentialsInFlight(t *testing.T) {
+	p := NewWithCredentials("old", "old")
+	// a private call in flight holds the mutex until it is answered
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		p.SetCredentials(Credentials{"new", "new"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("SetCredentials waited for the call in flight")
+	}
+	if key, secret := p.keys(); key != "new" || secret != "new" {
+		t.Errorf("unexpected credentials %q %q", key, secret)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(20)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		r.Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("5 calls at 20/s took only %v", elapsed)
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	for _, perSecond := range []int{0, -1} {
+		r := NewRateLimiter(perSecond)
+		start := time.Now()
+		for i := 0; i < 100; i++ {
+			r.Wait()
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("%d/s waited %v", perSecond, elapsed)
+		}
+	}
+}
+
+func TestRateLimiterOutsideMutex(t *testing.T) {
+	p, _ := newTestClient(t)
+	r := NewRateLimiter(1)
+	r.Wait()
+	p.UseRateLimiter(r)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Balances()
+	}()
+	time.Sleep(100 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		p.mutex.Lock()
+		p.mutex.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("throttled call holds the mutex")
+	}
+	<-done
+}
+
+func TestContextCancelled(t *testing.T) {
+	p, _ := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.BuyContext(ctx, "BTC_ETH", d("0.02"), d("1")); err != context.Canceled {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if oo, err := p.OpenOrders("BTC_ETH"); err != nil || len(oo) != 0 {
+		t.Fatalf("cancelled order was sent: %+v %v", oo, err)
+	}
+
+	r := NewRateLimiter(1)
+	r.Wait()
+	p.UseRateLimiter(r)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.OpenOrdersContext(ctx, "BTC_ETH"); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled wait took %v", elapsed)
+	}
+	// the turn given up is taken by the next call
+	r.mu.Lock()
+	next := time.Until(r.next)
+	r.mu.Unlock()
+	if next > time.Second {
+		t.Errorf("cancelled wait kept its turn, next in %v", next)
+	}
+}
+
+func TestAccountManager(t *testing.T) {
+	a, _ := newTestClient(t)
+	b, srvB := newTestClient(t)
+	srvB.SetBalance("BTC", 2)
+	m := NewAccountManager(0)
+	m.Add("a", a)
+	m.Add("b", b)
+	if names := m.Names(); len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("unexpected names %v", names)
+	}
+
+	if _, err := m.Buy("b", "BTC_ETH", d("0.02"), d("1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Buy("c", "BTC_ETH", d("0.02"), d("1")); err == nil {
+		t.Error("order routed to an unknown account")
+	}
+	o, err := m.OpenOrdersAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o["a"]["BTC_ETH"]) != 0 || len(o["b"]["BTC_ETH"]) != 1 {
+		t.Errorf("unexpected open orders %+v", o)
+	}
+	total, err := m.TotalBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total["BTC"].Available.String() != "2.98000000" || total["BTC"].OnOrders.String() != "0.02000000" || f(total["ETH"].Available) != 20 {
+		t.Errorf("unexpected total balances %+v", total)
+	}
+
+	// the shared limiter only lasts while the client is managed
+	own := NewRateLimiter(6)
+	c, _ := newTestClient(t)
+	c.UseRateLimiter(own)
+	m.Add("c", c)
+	if c.limiter != m.limiter {
+		t.Error("added client doesn't share the limit")
+	}
+	m.Remove("c")
+	if c.limiter != own {
+		t.Error("removed client didn't get its own limiter back")
+	}
+	m.Add("b", c)
+	if b.limiter != nil || c.limiter != m.limiter {
+		t.Errorf("replaced client kept the shared limiter")
+	}
+}
+
+type testLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *testLogger) add(level, msg string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, fmt.Sprint(level, " ", msg, " ", args))
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) { l.add("DEBUG", msg, args) }
+func (l *testLogger) Info(msg string, args ...interface{})  { l.add("INFO", msg, args) }
+func (l *testLogger) Warn(msg string, args ...interface{})  { l.add("WARN", msg, args) }
+func (l *testLogger) Error(msg string, args ...interface{}) { l.add("ERROR", msg, args) }
+
+var _ Logger = slog.Default()
+
+func TestLogger(t *testing.T) {
+	p, _ := newTestClient(t)
+	l := &testLogger{}
+	p.SetLogger(l)
+	if _, err := p.Ticker(); err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) != 1 || !strings.HasPrefix(l.entries[0], "DEBUG request [kind public command returnTicker status 200 latency") {
+		t.Errorf("unexpected log %q", l.entries)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	p, _ := newTestClient(t)
+	seen := []string{}
+	p.Use(func(next Handler) Handler {
+		return func(r *Request) (*Response, error) {
+			r.Headers["X-Audit"] = "test"
+			res, err := next(r)
+			if err == nil {
+				seen = append(seen, r.Kind+" "+r.Command+" "+strconv.Itoa(res.Status))
+			}
+			return res, err
+		}
+	}, func(next Handler) Handler {
+		return func(r *Request) (*Response, error) {
+			if r.Command == "returnCurrencies" {
+				return nil, errors.New("injected")
+			}
+			return next(r)
+		}
+	})
+
+	if _, err := p.Currencies(); err == nil || err.Error() != "injected" {
+		t.Errorf("fault not injected: %v", err)
+	}
+	if _, err := p.Ticker(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Balances(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != "public returnTicker 200" || seen[1] != "private returnCompleteBalances 200" {
+		t.Errorf("unexpected calls %v", seen)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	p, _ := newTestClient(t)
+	_, err := p.Sell("BTC_ETH", d("0.05"), d("100"))
+	if !errors.Is(err, &APIError{Kind: ErrorInsufficientFunds}) {
+		t.Errorf("unexpected error %v", err)
+	}
+	_, err = p.CancelOrder(1)
+	if e, ok := err.(*APIError); !ok || e.Kind != ErrorUnknownOrder || e.Command != "cancelOrder" {
+		t.Errorf("unexpected error %v", err)
+	}
+	p.Secret = "wrong"
+	if _, err := p.Balances(); !errors.Is(err, &APIError{Kind: ErrorAuth}) {
+		t.Errorf("unexpected error %v", err)
+	}
+	for msg, kind := range map[string]ErrorKind{
+		"Nonce must be greater than 1. You provided 0.":        ErrorNonce,
+		"Please do not make more than 6 API calls per second.": ErrorRateLimit,
+		"Unable to place post-only order at this price.":       ErrorRejected,
+		"Invalid currencyPair parameter.":                      ErrorInvalidRequest,
+	} {
+		if k := errorKind(msg, 200); k != kind {
+			t.Errorf("%q is %s, not %s", msg, k, kind)
+		}
+	}
+}
+
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+type spanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span) {
+	s := &testSpan{name: name, attrs: map[string]interface{}{}}
+	s.parent, _ = ctx.Value(spanKey{}).(*testSpan)
+	s.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *testSpan) SetAttributes(attrs ...interface{}) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		s.attrs[attrs[i].(string)] = attrs[i+1]
+	}
+}
+
+func (s *testSpan) End(err error) {
+	s.err, s.ended = err, true
+}
+
+func TestTracer(t *testing.T) {
+	p, _ := newTestClient(t)
+	tr := &testTracer{}
+	p.SetTracer(tr)
+
+	ctx, strategy := tr.Start(context.Background(), "strategy")
+	buy, err := p.BuyContext(ctx, "BTC_ETH", d("0.029"), d("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.CancelOrderContext(ctx, buy.OrderNumber); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Sell("BTC_ETH", d("0.05"), d("100")); err == nil {
+		t.Fatal("sold more than the balance")
+	}
+	strategy.End(nil)
+
+	if len(tr.spans) != 4 {
+		t.Fatalf("%d spans", len(tr.spans))
+	}
+	b, c, s := tr.spans[1], tr.spans[2], tr.spans[3]
+	if b.name != "poloniex.buy" || b.parent != strategy || b.attrs["poloniex.pair"] != "BTC_ETH" || b.attrs["http.status_code"] != 200 {
+		t.Errorf("unexpected buy span %+v", b)
+	}
+	if c.name != "poloniex.cancelOrder" || c.parent != strategy || c.attrs["poloniex.order_number"] != strconv.FormatInt(buy.OrderNumber, 10) {
+		t.Errorf("unexpected cancel span %+v", c)
+	}
+	if s.parent != nil || !s.ended || !errors.Is(s.err, &APIError{Kind: ErrorInsufficientFunds}) {
+		t.Errorf("unexpected sell span %+v", s)
+	}
+}
+
+func TestOrderTracker(t *testing.T) {
+	p, srv := newTestClient(t)
+	tr := p.NewOrderTracker(0)
+	defer tr.Stop()
+	next := func(number int64, state OrderState) TrackedOrder {
+		t.Helper()
+		select {
+		case e := <-tr.C:
+			if e.Order.OrderNumber != number || e.Order.State != state {
+				t.Fatalf("expected order %d %s, got %+v", number, state, e)
+			}
+			return e.Order
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event for order %d", state, number)
+		}
+		return TrackedOrder{}
+	}
+
+	buy, err := tr.Buy("BTC_ETH", d("0.029"), d("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(buy.OrderNumber, OrderOpen)
+
+	srv.Trade("BTC_ETH", "buy", 0.029, 0.5)
+	if err := tr.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	o := next(buy.OrderNumber, OrderPartiallyFilled)
+	if f(o.Filled) != 0.5 || f(o.AvgPrice) != 0.029 {
+		t.Errorf("unexpected fill %+v", o)
+	}
+
+	moved, err := tr.Move(buy.OrderNumber, d("0.0295"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := next(buy.OrderNumber, OrderMoved); o.MovedTo != moved.OrderNumber {
+		t.Errorf("unexpected move %+v", o)
+	}
+	if o := next(moved.OrderNumber, OrderPartiallyFilled); o.MovedFrom != buy.OrderNumber || f(o.Filled) != 0.5 {
+		t.Errorf("fills not carried over %+v", o)
+	}
+
+	srv.Trade("BTC_ETH", "buy", 0.0295, 1.5)
+	if err := tr.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	o = next(moved.OrderNumber, OrderFilled)
+	if f(o.Filled) != 2 || f(o.AvgPrice) != 0.029375 {
+		t.Errorf("unexpected fill %+v", o)
+	}
+
+	sell, err := tr.Sell("BTC_ETH", d("0.04"), d("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next(sell.OrderNumber, OrderOpen)
+	if _, err := p.CancelOrder(sell.OrderNumber); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	next(sell.OrderNumber, OrderCancelled)
+}
+
+func TestTrackedOrderSum(t *testing.T) {
+	o := &trackedOrder{TrackedOrder: TrackedOrder{Amount: d("0.3")}, trades: map[int64]fill{
+		1: {rate: toRat(d("0.03")), amount: toRat(d("0.1"))},
+		2: {rate: toRat(d("0.06")), amount: toRat(d("0.2"))},
+	}}
+	o.sum()
+	if o.Filled.String() != "0.30000000" || o.AvgPrice.String() != "0.05000000" || o.progress() != OrderFilled {
+		t.Errorf("unexpected sum %+v %s", o.TrackedOrder, o.progress())
+	}
+	o.Amount = d("0.30000001")
+	if o.progress() != OrderPartiallyFilled {
+		t.Errorf("order short of a satoshi counted as %s", o.progress())
+	}
+}
+
+func TestOrderTrackerMoveNotifications(t *testing.T) {
+	p, srv := newTestClient(t)
+	tr := p.NewOrderTracker(0)
+	// give the subscription time to reach the server before pushing
+	time.Sleep(100 * time.Millisecond)
+	// the exchange reports the cancel of the old number and a fill of the new one before the move is answered
+	p.Use(func(next Handler) Handler {
+		return func(r *Request) (*Response, error) {
+			res, err := next(r)
+			if err != nil || r.Command != "moveOrder" {
+				return res, err
+			}
+			m := MoveOrder{}
+			if err := decodePrivate(res.Body, &m); err != nil {
+				return nil, err
+			}
+			srv.Push(1000, "", []interface{}{
+				[]interface{}{"o", r.Params.Get("orderNumber"), "0.00000000", "c"},
+				[]interface{}{"t", 99, "0.0295", "0.5", "0.99", 0, float64(m.OrderNumber)},
+			})
+			time.Sleep(200 * time.Millisecond)
+			return res, nil
+		}
+	})
+	next := func() OrderEvent {
+		t.Helper()
+		select {
+		case e := <-tr.C:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+		return OrderEvent{}
+	}
+
+	buy, err := tr.Buy("BTC_ETH", d("0.029"), d("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next()
+	moved, err := tr.Move(buy.OrderNumber, d("0.0295"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); e.Order.OrderNumber != buy.OrderNumber || e.Order.State != OrderMoved {
+		t.Errorf("expected the move, got %+v", e)
+	}
+	if e := next(); e.Order.OrderNumber != moved.OrderNumber || e.Order.State != OrderPartiallyFilled || f(e.Order.Filled) != 0.5 {
+		t.Errorf("fill of the new number lost %+v", e)
+	}
+
+	// stopping twice at once must not close the channels twice
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tr.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOrderValidator(t *testing.T) {
+	p, srv := newTestClient(t)
+	v := NewOrderValidator(p)
+	v.MaxAge = 0
+	p.UseValidator(v)
+	invalid := func(err error, reason string) {
+		t.Helper()
+		e, ok := err.(*ValidationError)
+		if !ok || !strings.Contains(e.Reason, reason) {
+			t.Errorf("expected %q, got %v", reason, err)
+		}
+	}
+
+	_, err := p.Buy("BTC_ETH", d("0.029"), d("0.001"))
+	invalid(err, "below the minimum")
+	_, err = p.Buy("BTC_ETH", d("0.029"), d("0.123456789"))
+	invalid(err, "more than 8 decimals")
+	_, err = p.Sell("BTC_XYZ", d("0.029"), d("1"))
+	invalid(err, "unknown market")
+
+	v.Round = true
+	buy, err := p.Buy("BTC_ETH", d("0.029"), d("0.123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	open, err := p.OpenOrders("BTC_ETH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].OrderNumber != buy.OrderNumber || f(open[0].Amount) != 0.12345678 {
+		t.Errorf("amount not rounded down %+v", open)
+	}
+	rate, _, err := v.Order("sell", "BTC_ETH", d("0.0300000001"), d("1"))
+	if err != nil || rate.String() != "0.03000001" {
+		t.Errorf("sell rate not rounded up: %s %v", rate, err)
+	}
+	// too many digits for a float64 to round them right
+	if _, amount, err := v.Order("buy", "BTC_ETH", d("0.029"), d("12345678.123456789")); err != nil || amount.String() != "12345678.12345678" {
+		t.Errorf("amount not cut off exactly: %s %v", amount, err)
+	}
+	if _, _, err := v.Order("buy", "BTC_ETH", d("0.0001"), d("1")); err != nil {
+		t.Errorf("total at the minimum rejected: %v", err)
+	}
+
+	srv.SetTicker("TRX_ETH", poloniextest.Ticker{Last: 100})
+	_, _, err = v.Order("buy", "TRX_ETH", d("100"), d("1"))
+	invalid(err, "minimum total unknown")
+	v.SetRule("TRX_ETH", MarketRule{PricePrecision: 8, AmountPrecision: 8, MinTotal: d("10")})
+	_, _, err = v.Order("buy", "TRX_ETH", d("1"), d("1"))
+	invalid(err, "below the minimum of 10")
+	if _, _, err := v.Order("buy", "TRX_ETH", d("100"), d("1")); err != nil {
+		t.Errorf("order on a market with a rule rejected: %v", err)
+	}
+
+	srv.SetFrozen("BTC_ETH", true)
+	_, err = p.Move(buy.OrderNumber, d("0.0291"))
+	invalid(err, "market is frozen")
+	srv.SetFrozen("BTC_ETH", false)
+	srv.SetCurrency("ETH", poloniextest.Currency{ID: 267, Name: "Ethereum", Delisted: true})
+	_, err = p.Sell("BTC_ETH", d("0.04"), d("1"))
+	invalid(err, "ETH is delisted")
+}
+
+func TestMarkets(t *testing.T) {
+	p, srv := newTestClient(t)
+	srv.SetTicker("USDT_BTC", poloniextest.Ticker{Last: 6400, BaseVolume: 1e6, QuoteVolume: 150})
+	srv.SetFrozen("BTC_FCT", true)
+	srv.SetCurrency("ETH", poloniextest.Currency{ID: 267, Name: "Ethereum", Delisted: true})
+
+	if _, err := ParsePair("BTCETH"); err == nil {
+		t.Error("parsed a pair without separator")
+	}
+	pair, err := ParsePair("BTC_ETH")
+	if err != nil || pair.Base != "BTC" || pair.Quote != "ETH" || pair.String() != "BTC_ETH" {
+		t.Fatalf("unexpected pair %+v %v", pair, err)
+	}
+
+	m := NewMarkets(p)
+	if err := m.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if all := m.AllPairs(); len(all) != 3 {
+		t.Errorf("unexpected pairs %v", all)
+	}
+	if active := m.Pairs(); len(active) != 1 || active[0] != (Pair{"USDT", "BTC"}) {
+		t.Errorf("unexpected active pairs %v", active)
+	}
+	if bases := m.Bases(); len(bases) != 1 || bases[0] != "USDT" {
+		t.Errorf("unexpected bases %v", bases)
+	}
+	if eth, ok := m.Market(pair); !ok || eth.Inactive() != "ETH is delisted" || f(eth.Ticker.Last) != 0.0305 {
+		t.Errorf("unexpected market %+v", eth)
+	}
+	if fct, _ := m.Market(Pair{"BTC", "FCT"}); !fct.Frozen || fct.Active() {
+		t.Errorf("unexpected market %+v", fct)
+	}
+	if c, ok := m.Currency("BTC"); !ok || c.ID != 28 {
+		t.Errorf("unexpected currency %+v", c)
+	}
+}
+
+func TestMarketsFresh(t *testing.T) {
+	p, _ := newTestClient(t)
+	var mu sync.Mutex
+	tickers := 0
+	p.Use(func(next Handler) Handler {
+		return func(r *Request) (*Response, error) {
+			if r.Command == "returnTicker" {
+				mu.Lock()
+				tickers++
+				mu.Unlock()
+				time.Sleep(100 * time.Millisecond)
+			}
+			return next(r)
+		}
+	})
+	m := NewMarkets(p)
+	if err := m.RefreshEvery(0); err == nil {
+		t.Error("refresh interval of 0 accepted")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.fresh(time.Minute); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if tickers != 1 {
+		t.Errorf("%d refreshes for concurrent callers", tickers)
+	}
+	if len(m.AllPairs()) == 0 {
+		t.Error("registry not refreshed")
+	}
+}
+
+func TestPegger(t *testing.T) {
+	p, srv := newTestClient(t)
+	modify := func(seq int64, rate string) {
+		srv.Publish("BTC_ETH", []interface{}{map[string]interface{}{
+			"type": "orderBookModify",
+			"data": map[string]interface{}{"type": "bid", "rate": rate, "amount": "5.00000000"},
+		}}, map[string]interface{}{"seq": seq})
+	}
+	waitRate := func(g *Pegger, rate float64) {
+		t.Helper()
+		for i := 0; i < 200 && g.Rate() != rate; i++ {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if g.Rate() != rate {
+			t.Fatalf("pegged at %v, not %v", g.Rate(), rate)
+		}
+	}
+
+	g, err := p.Peg("BTC_ETH", "buy", d("1"), PegConfig{Limit: 0.0302, PostOnly: true, MinInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := g.OrderNumber()
+	if g.Rate() != 0.030 {
+		t.Errorf("placed at %v", g.Rate())
+	}
+
+	modify(1, "0.03010000")
+	waitRate(g, 0.0301)
+	if g.OrderNumber() == first {
+		t.Error("order number not updated after move")
+	}
+	modify(2, "0.03050000")
+	waitRate(g, 0.0302)
+
+	if _, err := p.MovePostOnly(g.OrderNumber(), d("0.032")); !errors.Is(err, &APIError{Kind: ErrorRejected}) {
+		t.Errorf("post-only move took liquidity: %v", err)
+	}
+	if ok, err := g.Cancel(); err != nil || !ok {
+		t.Fatalf("cancel failed %v %v", ok, err)
+	}
+	if open, _ := p.OpenOrders("BTC_ETH"); len(open) != 0 {
+		t.Errorf("orders left %+v", open)
+	}
+}
+
+func TestPeggerEnds(t *testing.T) {
+	p, _ := newTestClient(t)
+	c := PegConfig{CheckInterval: 20 * time.Millisecond}
+	done := func(g *Pegger) {
+		t.Helper()
+		select {
+		case <-g.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("pegging didn't end")
+		}
+	}
+
+	// cancelled elsewhere, noticed without a move
+	g, err := p.Peg("BTC_ETH", "buy", d("1"), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.CancelOrder(g.OrderNumber()); err != nil {
+		t.Fatal(err)
+	}
+	done(g)
+	if g.Err() != nil {
+		t.Errorf("unexpected error %v", g.Err())
+	}
+
+	// the order book feed ends
+	g, err = p.Peg("BTC_ETH", "buy", d("1"), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	done(g)
+	if g.Err() == nil {
+		t.Error("end of the order book feed not reported")
+	}
+}
+
+func TestConditionalOrders(t *testing.T) {
+	p, srv := newTestClient(t)
+	store := FileConditionStore(filepath.Join(t.TempDir(), "conditions.json"))
+	c, err := p.NewConditionalOrders(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop, profit, err := c.AddOCO(
+		Condition{Pair: "BTC_ETH", Side: "sell", Amount: d("1"), Kind: StopLoss, Trigger: 0.028, MaxSlippage: 0.01},
+		Condition{Pair: "BTC_ETH", Side: "sell", Amount: d("1"), Kind: TakeProfit, Trigger: 0.035, MaxSlippage: 0.01},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailing, err := c.Add(Condition{Pair: "BTC_ETH", Side: "sell", Amount: d("1"), Kind: TrailingStop, TrailBy: 0.002, MaxSlippage: 0.02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Add(Condition{Pair: "BTC_ETH", Side: "sell", Amount: d("1"), Kind: StopLoss}); err == nil {
+		t.Error("stop loss without trigger accepted")
+	}
+
+	c.Check("BTC_ETH", 0.031)
+	c.Check("BTC_ETH", 0.0325)
+	c.Stop()
+
+	// the pending conditions and the peak of the trailing stop survive a restart
+	c, err = p.NewConditionalOrders(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	pending := c.Pending()
+	if len(pending) != 3 || pending[2].ID != trailing || pending[2].Extreme != 0.0325 || pending[0].OCO != profit {
+		t.Fatalf("unexpected pending %+v", pending)
+	}
+
+	srv.PublishTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0304})
+	select {
+	case e := <-c.C:
+		if e.Err != nil || e.Condition.ID != trailing || e.OrderNumber == 0 || f(e.Unfilled) != 0 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("trailing stop didn't fire")
+	}
+
+	c.Check("BTC_ETH", 0.027)
+	select {
+	case e := <-c.C:
+		if e.Condition.ID != stop || e.OrderNumber == 0 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stop loss didn't fire")
+	}
+	if pending := c.Pending(); len(pending) != 0 {
+		t.Errorf("take profit not cancelled by its stop loss %+v", pending)
+	}
+	if loaded, _ := store.Load(); len(loaded) != 0 {
+		t.Errorf("fired conditions still stored %+v", loaded)
+	}
+
+	// an order the book can't fill within the slippage doesn't rest in it
+	if _, err := c.Add(Condition{Pair: "BTC_ETH", Side: "buy", Amount: d("1"), Kind: StopLoss, Trigger: 0.02}); err != nil {
+		t.Fatal(err)
+	}
+	c.Check("BTC_ETH", 0.025)
+	select {
+	case e := <-c.C:
+		if e.Err != nil || f(e.Unfilled) != 1 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("buy stop didn't fire")
+	}
+	if open, _ := p.OpenOrders("BTC_ETH"); len(open) != 0 {
+		t.Errorf("condition orders rest in the book %+v", open)
+	}
+}
+
+type countingStore struct {
+	mu    sync.Mutex
+	saves int
+	last  []Condition
+}
+
+func (s *countingStore) Load() ([]Condition, error) { return nil, nil }
+
+func (s *countingStore) Save(conditions []Condition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves++
+	s.last = conditions
+	return nil
+}
+
+func TestConditionalOrdersSaves(t *testing.T) {
+	p, _ := newTestClient(t)
+	store := &countingStore{}
+	c, err := p.NewConditionalOrders(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Add(Condition{Pair: "BTC_ETH", Side: "sell", Amount: d("1"), Kind: TrailingStop, TrailBy: 0.01}); err != nil {
+		t.Fatal(err)
+	}
+	for price := 0.031; price < 0.032; price += 0.0001 {
+		c.Check("BTC_ETH", price)
+	}
+	store.mu.Lock()
+	saves := store.saves
+	store.mu.Unlock()
+	if saves != 1 {
+		t.Errorf("%d saves for moves of the extreme right after adding", saves)
+	}
+	c.Stop()
+	if store.saves != 2 || len(store.last) != 1 || store.last[0].Extreme < 0.0319 {
+		t.Errorf("extreme not saved on stop: %d saves, %+v", store.saves, store.last)
+	}
+}
+
+func TestMarketOrders(t *testing.T) {
+	p, _ := newTestClient(t)
+	if _, err := p.MarketBuy("BTC_ETH", MarketSize{}, 0.01); err == nil {
+		t.Error("market order without size accepted")
+	}
+
+	m, err := p.MarketBuy("BTC_ETH", MarketSize{Amount: d("15")}, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f(m.Rate) != 0.032 || f(m.Filled) != 15 || f(m.Unfilled) != 0 || m.Total.String() != "0.47000000" || len(m.Trades) != 2 {
+		t.Errorf("unexpected buy %+v", m)
+	}
+
+	// only the best bid is within the slippage, the rest of the order is cancelled
+	m, err = p.MarketSell("BTC_ETH", MarketSize{Amount: d("20")}, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f(m.Rate) != 0.0297 || f(m.Filled) != 10 || f(m.Unfilled) != 10 || f(m.AvgPrice) != 0.03 {
+		t.Errorf("unexpected sell %+v", m)
+	}
+	if open, _ := p.OpenOrders("BTC_ETH"); len(open) != 0 {
+		t.Errorf("immediate-or-cancel order left in the book %+v", open)
+	}
+
+	m, err = p.MarketBuy("BTC_ETH", MarketSize{Total: d("0.1")}, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Amount.String() != "3.12500000" || f(m.Filled) != 3.125 || m.Total.String() != "0.10000000" {
+		t.Errorf("unexpected buy for a total %+v", m)
+	}
+
+	// a total the rate doesn't divide, the amount is cut off so it never costs more than the total
+	m, err = p.MarketBuy("BTC_ETH", MarketSize{Total: d("0.12345678")}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Amount.String() != "3.85802437" || new(big.Rat).Mul(toRat(m.Amount), toRat(m.Rate)).Cmp(toRat(d("0.12345678"))) > 0 {
+		t.Errorf("unexpected buy for a total %+v", m)
+	}
+}
+
+func TestTickerCache(t *testing.T) {
+	p, srv := newTestClient(t)
+	c, err := p.NewTickerCache(20 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitLast := func(last float64) {
+		t.Helper()
+		for i := 0; i < 200; i++ {
+			if e, ok := c.Get("BTC_ETH"); ok && f(e.Last) == last {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("cache didn't get %v", last)
+	}
+	waitLast(0.0305)
+
+	for i := 0; i < 200 && func() bool { e, _ := c.Get("BTC_ETH"); return f(e.Last) != 0.0309 }(); i++ {
+		srv.PublishTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0309})
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitLast(0.0309)
+
+	// once the client is closed the cache polls without opening the websocket again
+	p.Close()
+	srv.SetTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0311})
+	waitLast(0.0311)
+	time.Sleep(50 * time.Millisecond)
+	p.wsMutex.Lock()
+	reopened := p.ws != nil
+	p.wsMutex.Unlock()
+	if reopened {
+		t.Error("websocket opened again after Close")
+	}
+}
+
+func TestTickerCacheSocketDown(t *testing.T) {
+	p, srv := newTestClient(t)
+	p.UseEndpoints(Endpoints{Public: srv.PublicURL, Private: srv.PrivateURL, WS: "ws://127.0.0.1:1", Push: srv.PushURL})
+	c, err := p.NewTickerCache(20 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetTicker("BTC_ETH", poloniextest.Ticker{Last: 0.0311})
+	for i := 0; i < 100; i++ {
+		if e, _ := c.Get("BTC_ETH"); f(e.Last) == 0.0311 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e, _ := c.Get("BTC_ETH"); f(e.Last) != 0.0311 {
+		t.Errorf("not polled while the websocket is down %+v", e)
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the websocket")
+	}
 }
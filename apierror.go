@@ -0,0 +1,123 @@
+package poloniex
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	//ErrorKind classifies the errors Poloniex answers calls with
+	ErrorKind string
+
+	//APIError is an error Poloniex answered a call with, either in the "error" field of the response
+	//or as a server error status
+	APIError struct {
+		Command string
+		Status  int
+		Message string
+		Kind    ErrorKind
+	}
+
+	// sentError is a transport error of a call that may have reached Poloniex, like a timeout waiting for
+	// the response, unlike a call given up before it was sent
+	sentError struct {
+		err error
+	}
+)
+
+const (
+	// ErrorNonce is a nonce that wasn't greater than the last one used with the key
+	ErrorNonce ErrorKind = "nonce"
+	// ErrorAuth is an invalid key or signature, or a key lacking the permission for the command
+	ErrorAuth ErrorKind = "auth"
+	// ErrorRateLimit is too many calls from the same IP
+	ErrorRateLimit ErrorKind = "rate_limit"
+	// ErrorInsufficientFunds is a balance too low for an order, transfer or withdrawal
+	ErrorInsufficientFunds ErrorKind = "insufficient_funds"
+	// ErrorUnknownOrder is an order number that doesn't belong to an open order of the account
+	ErrorUnknownOrder ErrorKind = "unknown_order"
+	// ErrorRejected is a valid order the exchange wouldn't place, e.g. a post-only order that would take
+	// liquidity, a fill-or-kill order that can't be filled or an order on a frozen market
+	ErrorRejected ErrorKind = "rejected"
+	// ErrorInvalidRequest is a command or parameter the exchange doesn't accept
+	ErrorInvalidRequest ErrorKind = "invalid_request"
+	// ErrorServer is a failure on the side of the exchange
+	ErrorServer ErrorKind = "server"
+	// ErrorOther is any other error
+	ErrorOther ErrorKind = "other"
+)
+
+func (e *APIError) Error() string {
+	return e.Command + ": " + e.Message
+}
+
+// Is makes errors.Is(err, &APIError{Kind: k}) match APIErrors of kind k
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Kind == e.Kind && (t.Command == "" || t.Command == e.Command)
+}
+
+func (e *sentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *sentError) Unwrap() error {
+	return e.err
+}
+
+// apiError returns the error Poloniex answered command with, nil if the response isn't an error
+func apiError(command string, status int, body string) error {
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, "{") {
+		e := struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal([]byte(trimmed), &e) == nil && e.Error != "" {
+			return &APIError{Command: command, Status: status, Message: e.Error, Kind: errorKind(e.Error, status)}
+		}
+	}
+	if status >= 500 || status == http.StatusTooManyRequests {
+		msg := http.StatusText(status)
+		if msg == "" {
+			msg = "status " + strconv.Itoa(status)
+		}
+		return &APIError{Command: command, Status: status, Message: msg, Kind: errorKind(msg, status)}
+	}
+	return nil
+}
+
+func errorKind(msg string, status int) ErrorKind {
+	m := strings.ToLower(msg)
+	switch {
+	case status == http.StatusTooManyRequests || strings.Contains(m, "api calls per second"):
+		return ErrorRateLimit
+	case strings.Contains(m, "nonce"):
+		return ErrorNonce
+	case strings.Contains(m, "api key") || strings.Contains(m, "permission"):
+		return ErrorAuth
+	case strings.HasPrefix(m, "not enough") || strings.Contains(m, "insufficient"):
+		return ErrorInsufficientFunds
+	case strings.Contains(m, "order number") || strings.Contains(m, "order not found"):
+		return ErrorUnknownOrder
+	case strings.HasPrefix(m, "unable to") || strings.Contains(m, "frozen") || strings.Contains(m, "disabled"):
+		return ErrorRejected
+	case strings.Contains(m, "invalid") || strings.Contains(m, "required"):
+		return ErrorInvalidRequest
+	case status >= 500:
+		return ErrorServer
+	}
+	return ErrorOther
+}
+
+// errorLabel is the kind of err for metrics, "transport" for errors that didn't come from Poloniex
+func errorLabel(err error) string {
+	if err == nil {
+		return ""
+	}
+	if e, ok := err.(*APIError); ok {
+		return string(e.Kind)
+	}
+	return "transport"
+}
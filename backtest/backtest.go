@@ -0,0 +1,140 @@
+// Package backtest replays historical candles or trades of Poloniex through a strategy and simulates
+// the fills of its orders, so strategies written against the poloniex client can be evaluated offline.
+package backtest
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api"
+	"github.com/hhh0pE/poloniex-api/internal/sim"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Trader is the order API a strategy trades through, both *poloniex.Poloniex and *Broker implement it
+	Trader interface {
+		Buy(pair string, rate, amount ggm.Decimal) (poloniex.Buy, error)
+		Sell(pair string, rate, amount ggm.Decimal) (poloniex.Sell, error)
+		CancelOrder(orderNumber int64) (bool, error)
+		OpenOrders(pair string) (poloniex.OpenOrders, error)
+	}
+
+	// Strategy is handed every event of the replayed history in time order
+	Strategy interface {
+		OnEvent(t Trader, e Event)
+	}
+
+	// StrategyFunc adapts a function to a Strategy
+	StrategyFunc func(t Trader, e Event)
+
+	// Event is one step of history, either a candle or a trade of Pair
+	Event struct {
+		Time   time.Time
+		Pair   string
+		Candle *poloniex.ChartDataEntry
+		Trade  *poloniex.TradeHistoryEntry
+	}
+
+	// Config of a backtest run
+	Config struct {
+		// Balances the account starts with
+		Balances map[string]float64
+		// MakerFee and TakerFee default to Poloniex' fees when both are zero
+		MakerFee float64
+		TakerFee float64
+		// Latency delays every order and cancel of the strategy, they take effect at the first event after it
+		Latency time.Duration
+		// Currency the equity is valued in, BTC by default
+		Currency string
+	}
+
+	// Report of a backtest run
+	Report struct {
+		Start       time.Time
+		End         time.Time
+		StartEquity float64
+		EndEquity   float64
+		// PL is EndEquity - StartEquity
+		PL float64
+		// MaxDrawdown is the largest fall of the equity from a previous peak, as a fraction of the peak
+		MaxDrawdown float64
+		// Balances are the final totals, available and on orders
+		Balances map[string]float64
+		// Trades are the fills of the strategy's orders, oldest first
+		Trades []Trade
+		// Errors are the failures of orders and cancels that were delayed by latency
+		Errors []error
+	}
+
+	// Trade is a fill of one of the strategy's orders
+	Trade struct {
+		Date        time.Time
+		OrderNumber int64
+		Pair        string
+		Type        string
+		Rate        float64
+		Amount      float64
+		Total       float64
+		Fee         float64
+		Maker       bool
+	}
+)
+
+// OnEvent calls f
+func (f StrategyFunc) OnEvent(t Trader, e Event) {
+	f(t, e)
+}
+
+// Candles turns chart data of pair into events, at the start of each candle
+func Candles(pair string, data poloniex.ChartData) []Event {
+	events := make([]Event, len(data))
+	for i := range data {
+		events[i] = Event{Time: time.Unix(data[i].Date, 0).UTC(), Pair: pair, Candle: &data[i]}
+	}
+	return events
+}
+
+// Trades turns the trade history of pair into events
+func Trades(pair string, data poloniex.TradeHistory) []Event {
+	events := make([]Event, len(data))
+	for i := range data {
+		date, _ := time.Parse(sim.DateFormat, data[i].Date)
+		events[i] = Event{Time: date, Pair: pair, Trade: &data[i]}
+	}
+	return events
+}
+
+// Run replays events through s and reports how its orders did. The events of all sets are merged in time order.
+// A candle fills resting buys down to its low and resting sells up to its high, then new orders
+// trade against its close; a trade fills resting orders it crosses, then new orders trade against its rate.
+// The volume of the candle or trade limits the liquidity in both cases.
+func Run(c Config, s Strategy, events ...[]Event) (*Report, error) {
+	all := []Event{}
+	for _, e := range events {
+		all = append(all, e...)
+	}
+	if len(all) == 0 {
+		return nil, errors.New("no events to replay")
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.Before(all[j].Time) })
+
+	b := newBroker(c)
+	for _, e := range all {
+		b.step(e)
+		s.OnEvent(b, e)
+	}
+	return b.Report(), nil
+}
+
+func toFloat(d ggm.Decimal) float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+func toDecimal(f float64) ggm.Decimal {
+	d, _ := ggm.NewDecimalFromString(sim.F8(f))
+	return d
+}
@@ -0,0 +1,102 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api"
+)
+
+var _ Trader = (*poloniex.Poloniex)(nil)
+
+func d(s string) ggm.Decimal {
+	v, err := ggm.NewDecimalFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func candle(date int64, open, high, low, close, quoteVolume string) poloniex.ChartDataEntry {
+	return poloniex.ChartDataEntry{Date: date, Open: d(open), High: d(high), Low: d(low), Close: d(close), QuoteVolume: d(quoteVolume)}
+}
+
+func TestRunCandles(t *testing.T) {
+	data := poloniex.ChartData{
+		candle(0, "0.030", "0.031", "0.029", "0.030", "100"),
+		candle(300, "0.030", "0.030", "0.027", "0.028", "100"),
+		candle(600, "0.028", "0.033", "0.028", "0.032", "100"),
+	}
+	// buys 10 ETH at the first close and puts a sell up at 0.0325
+	s := StrategyFunc(func(tr Trader, e Event) {
+		if e.Candle.Date != 0 {
+			return
+		}
+		if _, err := tr.Buy(e.Pair, d("0.030"), d("10")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tr.Sell(e.Pair, d("0.0325"), d("9")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	r, err := Run(Config{Balances: map[string]float64{"BTC": 1}, MakerFee: 0.001, TakerFee: 0.002}, s, Candles("BTC_ETH", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Trades) != 2 || r.Trades[0].Maker || r.Trades[0].Rate != 0.030 || !r.Trades[1].Maker || r.Trades[1].Rate != 0.0325 {
+		t.Fatalf("unexpected trades %+v", r.Trades)
+	}
+	// 1 - 0.3 + 9*0.0325*0.999
+	if r.Balances["BTC"] != 0.99220750 || r.Balances["ETH"] != 0.98 {
+		t.Errorf("unexpected balances %+v", r.Balances)
+	}
+	if r.StartEquity != 1 || r.EndEquity != 1.0235675 || r.PL != 0.0235675 {
+		t.Errorf("unexpected equity %+v", r)
+	}
+	// 0.7 BTC and 9.98 ETH at 0.028 against the starting 1 BTC
+	if r.MaxDrawdown < 0.02055 || r.MaxDrawdown > 0.02057 {
+		t.Errorf("unexpected drawdown %v", r.MaxDrawdown)
+	}
+	if !r.End.Equal(time.Unix(600, 0)) {
+		t.Errorf("unexpected end %v", r.End)
+	}
+}
+
+func TestRunTradesWithLatency(t *testing.T) {
+	data := poloniex.TradeHistory{
+		{Date: "2017-06-01 10:00:02", Type: "sell", Rate: d("0.0299"), Amount: d("50")},
+		{Date: "2017-06-01 10:00:01", Type: "buy", Rate: d("0.0305"), Amount: d("1")},
+		{Date: "2017-06-01 10:00:00", Type: "buy", Rate: d("0.0300"), Amount: d("1")},
+	}
+	var number int64
+	s := StrategyFunc(func(tr Trader, e Event) {
+		if e.Trade.Rate.String() != "0.0300" {
+			return
+		}
+		b, err := tr.Buy(e.Pair, d("0.0299"), d("5"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		number = b.OrderNumber
+		if o, _ := tr.OpenOrders(e.Pair); len(o) != 0 {
+			t.Errorf("order arrived before the latency passed %+v", o)
+		}
+	})
+	r, err := Run(Config{Balances: map[string]float64{"BTC": 1}, Latency: 500 * time.Millisecond}, s, Trades("BTC_ETH", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Errors) != 0 {
+		t.Fatal(r.Errors)
+	}
+	if len(r.Trades) != 1 || r.Trades[0].OrderNumber != number || !r.Trades[0].Maker || r.Trades[0].Amount != 5 {
+		t.Fatalf("unexpected trades %+v", r.Trades)
+	}
+}
+
+func TestRunNoEvents(t *testing.T) {
+	if _, err := Run(Config{}, StrategyFunc(func(Trader, Event) {})); err == nil {
+		t.Error("run without events succeeded")
+	}
+}
@@ -0,0 +1,253 @@
+package backtest
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api"
+	"github.com/hhh0pE/poloniex-api/internal/sim"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Broker is the simulated account a strategy trades on during Run
+	Broker struct {
+		exchange *sim.Exchange
+		latency  time.Duration
+		currency string
+		now      time.Time
+
+		// the strategy sees order numbers of its own, an order only gets one on the exchange when it arrives
+		lastNumber int64
+		numbers    map[int64]int64
+		brokerNums map[int64]int64
+		pending    []action
+
+		prices      map[string]float64
+		started     bool
+		start       time.Time
+		startEquity float64
+		peak        float64
+		drawdown    float64
+		errs        []error
+	}
+
+	action struct {
+		due    time.Time
+		number int64
+		cancel bool
+		pair   string
+		side   sim.Side
+		rate   float64
+		amount float64
+	}
+)
+
+func newBroker(c Config) *Broker {
+	b := &Broker{
+		exchange:   sim.New(),
+		latency:    c.Latency,
+		currency:   c.Currency,
+		numbers:    map[int64]int64{},
+		brokerNums: map[int64]int64{},
+		prices:     map[string]float64{},
+	}
+	if b.currency == "" {
+		b.currency = "BTC"
+	}
+	if c.MakerFee != 0 || c.TakerFee != 0 {
+		b.exchange.MakerFee = c.MakerFee
+		b.exchange.TakerFee = c.TakerFee
+	}
+	b.exchange.Now = func() time.Time { return b.now }
+	for currency, amount := range c.Balances {
+		b.exchange.SetBalance(currency, amount)
+	}
+	return b
+}
+
+// Buy places a limit buy order
+func (b *Broker) Buy(pair string, rate, amount ggm.Decimal) (buy poloniex.Buy, err error) {
+	buy.OrderNumber, err = b.submit(action{pair: pair, side: sim.Buy, rate: toFloat(rate), amount: toFloat(amount)})
+	return
+}
+
+// Sell places a limit sell order
+func (b *Broker) Sell(pair string, rate, amount ggm.Decimal) (sell poloniex.Sell, err error) {
+	sell.OrderNumber, err = b.submit(action{pair: pair, side: sim.Sell, rate: toFloat(rate), amount: toFloat(amount)})
+	return
+}
+
+// CancelOrder cancels an order, an order that hasn't arrived yet is dropped
+func (b *Broker) CancelOrder(orderNumber int64) (success bool, err error) {
+	for i, a := range b.pending {
+		if !a.cancel && a.number == orderNumber {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			return true, nil
+		}
+	}
+	if _, ok := b.numbers[orderNumber]; !ok {
+		return false, errors.New(sim.ErrNoOrder.Error())
+	}
+	if _, err = b.submit(action{number: orderNumber, cancel: true}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// OpenOrders returns the orders of pair resting on the book
+func (b *Broker) OpenOrders(pair string) (openOrders poloniex.OpenOrders, err error) {
+	openOrders = poloniex.OpenOrders{}
+	for _, o := range b.exchange.OpenOrders(pair) {
+		openOrders = append(openOrders, poloniex.OpenOrder{
+			OrderNumber: b.brokerNums[o.Number],
+			Type:        o.Side.String(),
+			Rate:        toDecimal(o.Rate),
+			Amount:      toDecimal(o.Amount),
+			Total:       toDecimal(sim.Round(o.Rate * o.Amount)),
+		})
+	}
+	return
+}
+
+// Report describes the account at the current point of the run
+func (b *Broker) Report() *Report {
+	r := &Report{
+		Start:       b.start,
+		End:         b.now,
+		StartEquity: b.startEquity,
+		EndEquity:   b.equity(),
+		MaxDrawdown: b.drawdown,
+		Balances:    map[string]float64{},
+		Trades:      []Trade{},
+		Errors:      b.errs,
+	}
+	r.PL = sim.Round(r.EndEquity - r.StartEquity)
+	for c, bal := range b.exchange.Balances() {
+		r.Balances[c] = sim.Round(bal.Available + bal.OnOrders)
+	}
+	trades := b.exchange.Trades("")
+	for i := len(trades) - 1; i >= 0; i-- {
+		t := trades[i]
+		r.Trades = append(r.Trades, Trade{
+			Date:        t.Date,
+			OrderNumber: b.brokerNums[t.OrderNumber],
+			Pair:        t.Pair,
+			Type:        t.Side.String(),
+			Rate:        t.Rate,
+			Amount:      t.Amount,
+			Total:       t.Total,
+			Fee:         t.Fee,
+			Maker:       t.Maker,
+		})
+	}
+	return r
+}
+
+func (b *Broker) submit(a action) (int64, error) {
+	if !a.cancel {
+		if a.rate <= 0 || a.amount <= 0 {
+			return 0, errors.New(sim.ErrAmount.Error())
+		}
+		b.lastNumber++
+		a.number = b.lastNumber
+	}
+	if b.latency == 0 {
+		if err := b.execute(a); err != nil {
+			return 0, err
+		}
+		return a.number, nil
+	}
+	a.due = b.now.Add(b.latency)
+	b.pending = append(b.pending, a)
+	return a.number, nil
+}
+
+func (b *Broker) execute(a action) error {
+	if a.cancel {
+		if err := b.exchange.Cancel(b.numbers[a.number]); err != nil {
+			return errors.Wrap(err, "cancel of order "+strconv.FormatInt(a.number, 10)+" failed")
+		}
+		return nil
+	}
+	o, trades, err := b.exchange.Place(a.pair, a.side, a.rate, a.amount, sim.Options{})
+	if err != nil {
+		return errors.Wrap(err, a.side.String()+" order "+strconv.FormatInt(a.number, 10)+" failed")
+	}
+	number := int64(0)
+	if o != nil {
+		number = o.Number
+	} else if len(trades) > 0 {
+		number = trades[0].OrderNumber
+	}
+	b.numbers[a.number] = number
+	b.brokerNums[number] = a.number
+	return nil
+}
+
+// step moves the account to the time of e: resting orders are filled by e, the book is set from it
+// and orders and cancels that are due arrive
+func (b *Broker) step(e Event) {
+	b.now = e.Time
+	rate, amount := 0.0, 0.0
+	switch {
+	case e.Candle != nil:
+		rate, amount = toFloat(e.Candle.Close), toFloat(e.Candle.QuoteVolume)
+		b.exchange.Trade(e.Pair, sim.Buy, toFloat(e.Candle.Low), amount)
+		b.exchange.Trade(e.Pair, sim.Sell, toFloat(e.Candle.High), amount)
+	case e.Trade != nil:
+		rate, amount = toFloat(e.Trade.Rate), toFloat(e.Trade.Amount)
+		// a buyer takes the asks, so resting sells are filled, and the other way round
+		side := sim.Buy
+		if e.Trade.Type == "buy" {
+			side = sim.Sell
+		}
+		b.exchange.Trade(e.Pair, side, rate, amount)
+	default:
+		return
+	}
+	b.prices[e.Pair] = rate
+	book := []sim.Level{}
+	if amount > 0 {
+		book = append(book, sim.Level{Rate: rate, Amount: amount})
+	}
+	b.exchange.SetBook(e.Pair, book, append([]sim.Level{}, book...))
+
+	pending := b.pending[:0]
+	for _, a := range b.pending {
+		if a.due.After(b.now) {
+			pending = append(pending, a)
+			continue
+		}
+		if err := b.execute(a); err != nil {
+			b.errs = append(b.errs, err)
+		}
+	}
+	b.pending = pending
+
+	eq := b.equity()
+	if !b.started {
+		b.started, b.start, b.startEquity = true, b.now, eq
+	}
+	if eq > b.peak {
+		b.peak = eq
+	}
+	if b.peak > 0 && (b.peak-eq)/b.peak > b.drawdown {
+		b.drawdown = (b.peak - eq) / b.peak
+	}
+}
+
+// equity values every balance in the currency of the account at the last seen rates
+func (b *Broker) equity() float64 {
+	eq := 0.0
+	for c, bal := range b.exchange.Balances() {
+		total := bal.Available + bal.OnOrders
+		if c == b.currency {
+			eq += total
+		} else if rate, ok := b.prices[b.currency+"_"+c]; ok {
+			eq += total * rate
+		}
+	}
+	return sim.Round(eq)
+}
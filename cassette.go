@@ -0,0 +1,172 @@
+package poloniex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/beatgammit/turnpike.v2"
+)
+
+type (
+	//Cassette holds captured REST interactions and websocket frames, see Record and Replay
+	Cassette struct {
+		Interactions []Interaction `json:"interactions"`
+		Frames       []Frame       `json:"frames"`
+
+		mu     sync.Mutex
+		played map[int]bool
+	}
+
+	//Interaction is one captured REST call, the nonce is left out of Params and the Key and Sign headers are redacted
+	Interaction struct {
+		Kind     string            `json:"kind"`
+		Command  string            `json:"command"`
+		Params   url.Values        `json:"params"`
+		Headers  map[string]string `json:"headers,omitempty"`
+		Status   int               `json:"status"`
+		Response string            `json:"response"`
+	}
+
+	//Frame is one captured websocket message, either a WAMP event of Topic or a raw push message
+	Frame struct {
+		Topic  string                 `json:"topic"`
+		Args   []interface{}          `json:"args,omitempty"`
+		Kwargs map[string]interface{} `json:"kwargs,omitempty"`
+		Push   json.RawMessage        `json:"push,omitempty"`
+	}
+)
+
+const (
+	cassetteOff = iota
+	cassetteRecord
+	cassetteReplay
+
+	redacted = "REDACTED"
+)
+
+// LoadCassette reads a cassette written by Save
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading "+path+" failed")
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrap(err, "unmarshal of cassette "+path+" failed")
+	}
+	return c, nil
+}
+
+// Save writes the cassette to path
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Record captures every REST call and websocket frame of the client into c
+func (p *Poloniex) Record(c *Cassette) {
+	p.cassette = c
+	p.cassetteMode = cassetteRecord
+}
+
+// Replay serves every REST call of the client from c instead of the network, in recorded order for
+// repeated calls, and feeds websocket subscriptions from c when PlayFrames is called
+func (p *Poloniex) Replay(c *Cassette) {
+	p.cassette = c
+	p.cassetteMode = cassetteReplay
+}
+
+// PlayFrames hands every websocket frame of the replayed cassette to the current subscriptions, in order
+func (p *Poloniex) PlayFrames() error {
+	if p.cassetteMode != cassetteReplay {
+		return errors.New("not replaying a cassette")
+	}
+	for _, f := range p.cassette.Frames {
+		if len(f.Push) > 0 {
+			msg := []interface{}{}
+			if err := json.Unmarshal(f.Push, &msg); err != nil {
+				return errors.Wrap(err, "unmarshal of push frame failed")
+			}
+			p.dispatchPush(msg)
+			continue
+		}
+		p.wsMutex.Lock()
+		handler := p.replayTopics[f.Topic]
+		p.wsMutex.Unlock()
+		if handler != nil {
+			handler(f.Args, f.Kwargs)
+		}
+	}
+	return nil
+}
+
+func (c *Cassette) record(i Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, i)
+}
+
+func (c *Cassette) recordFrame(f Frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Frames = append(c.Frames, f)
+}
+
+// response returns the first interaction not played yet that matches the call
+func (c *Cassette) response(kind, command string, params url.Values) (Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.played == nil {
+		c.played = map[int]bool{}
+	}
+	want := withoutNonce(params).Encode()
+	for k, i := range c.Interactions {
+		if c.played[k] || i.Kind != kind || i.Command != command || i.Params.Encode() != want {
+			continue
+		}
+		c.played[k] = true
+		return i, nil
+	}
+	return Interaction{}, errors.New("no recorded " + kind + " interaction for " + command + " " + want)
+}
+
+func withoutNonce(params url.Values) url.Values {
+	v := url.Values{}
+	for k, vv := range params {
+		if k != "nonce" {
+			v[k] = append([]string{}, vv...)
+		}
+	}
+	return v
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	h := map[string]string{}
+	for k, v := range headers {
+		if k == "Key" || k == "Sign" {
+			v = redacted
+		}
+		h[k] = v
+	}
+	return h
+}
+
+// recordingHandler captures the events of a WAMP topic before handing them on
+func (p *Poloniex) recordingHandler(topic string, handler turnpike.EventHandler) turnpike.EventHandler {
+	if p.cassetteMode != cassetteRecord {
+		return handler
+	}
+	c := p.cassette
+	return func(args []interface{}, kwargs map[string]interface{}) {
+		c.recordFrame(Frame{Topic: topic, Args: args, Kwargs: kwargs})
+		handler(args, kwargs)
+	}
+}
@@ -0,0 +1,107 @@
+package poloniex
+
+import (
+	"context"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+)
+
+//go:generate go run ./internal/mockgen -o poloniexmock/client.go client.go
+
+type (
+	//PublicAPI is the public market data of the exchange
+	PublicAPI interface {
+		Ticker() (Ticker, error)
+		DailyVolume() (DailyVolume, error)
+		OrderBook(pair string) (OrderBook, error)
+		OrderBookAll() (OrderBookAll, error)
+		TradeHistory(in ...interface{}) (TradeHistory, error)
+		ChartData(pair string) (ChartData, error)
+		ChartDataPeriod(pair string, start, end time.Time) (ChartData, error)
+		ChartDataCurrent(pair string) (ChartData, error)
+		Currencies() (Currencies, error)
+		LoanOrders(currency string) (LoanOrders, error)
+	}
+
+	//TradingAPI is the account, order and wallet part of the trading API
+	TradingAPI interface {
+		Balances() (Balances, error)
+		AccountBalances() (AccountBalances, error)
+		AvailableAccountBalances() (AvailableAccountBalances, error)
+		TradableBalances() (TradableBalances, error)
+		TransferBalance(currency string, amount ggm.Decimal, from string, to string) (TransferBalance, error)
+		MarginAccountSummary() (MarginAccountSummary, error)
+		FeeInfo() (FeeInfo, error)
+		Addresses() (Addresses, error)
+		GenerateNewAddress(currency string) (string, error)
+		DepositsWithdrawals() (DepositsWithdrawals, error)
+		DepositsWithdrawalsRange(start, end time.Time) (DepositsWithdrawals, error)
+		Withdraw(currency string, amount ggm.Decimal, address string) (Withdraw, error)
+		WithdrawPaymentID(currency string, amount ggm.Decimal, address, paymentID string) (Withdraw, error)
+		OpenOrders(pair string) (OpenOrders, error)
+		OpenOrdersAll() (OpenOrdersAll, error)
+		PrivateTradeHistory(pair string) (PrivateTradeHistory, error)
+		PrivateTradeHistoryAll() (PrivateTradeHistoryAll, error)
+		OrderTrades(orderNumber int64) (OrderTrades, error)
+		Buy(pair string, rate, amount ggm.Decimal) (Buy, error)
+		BuyPostOnly(pair string, rate, amount ggm.Decimal) (Buy, error)
+		Sell(pair string, rate, amount ggm.Decimal) (Sell, error)
+		SellPostOnly(pair string, rate, amount ggm.Decimal) (Sell, error)
+		Move(orderNumber int64, rate ggm.Decimal) (MoveOrder, error)
+		MovePostOnly(orderNumber int64, rate ggm.Decimal) (MoveOrder, error)
+		MarketBuy(pair string, size MarketSize, maxSlippage float64) (MarketOrder, error)
+		MarketSell(pair string, size MarketSize, maxSlippage float64) (MarketOrder, error)
+		CancelOrder(orderNumber int64) (bool, error)
+		BuyContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (Buy, error)
+		SellContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (Sell, error)
+		MoveContext(ctx context.Context, orderNumber int64, rate ggm.Decimal) (MoveOrder, error)
+		CancelOrderContext(ctx context.Context, orderNumber int64) (bool, error)
+		BuyPostOnlyContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (Buy, error)
+		SellPostOnlyContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (Sell, error)
+		MovePostOnlyContext(ctx context.Context, orderNumber int64, rate ggm.Decimal) (MoveOrder, error)
+		MarketBuyContext(ctx context.Context, pair string, size MarketSize, maxSlippage float64) (MarketOrder, error)
+		MarketSellContext(ctx context.Context, pair string, size MarketSize, maxSlippage float64) (MarketOrder, error)
+		WithdrawContext(ctx context.Context, currency string, amount ggm.Decimal, address string) (Withdraw, error)
+		WithdrawPaymentIDContext(ctx context.Context, currency string, amount ggm.Decimal, address, paymentID string) (Withdraw, error)
+		OpenOrdersContext(ctx context.Context, pair string) (OpenOrders, error)
+		OrderTradesContext(ctx context.Context, orderNumber int64) (OrderTrades, error)
+	}
+
+	//LendingAPI is the margin lending part of the trading API
+	LendingAPI interface {
+		LoanOffer(currency string, amount ggm.Decimal, duration int, renew bool, lendingRate ggm.Decimal) (LoanOffer, error)
+		CancelLoanOffer(orderNumber int64) (bool, error)
+		OpenLoanOffers() (OpenLoanOffers, error)
+		ActiveLoans() (ActiveLoans, error)
+		ToggleAutoRenew(orderNumber int64) (bool, error)
+	}
+
+	//StreamAPI is the websocket feeds of the exchange
+	StreamAPI interface {
+		NewTickerSubscription() (*TickerSubscription, error)
+		NewOrderSubscription(code string) (*OrderSubscription, error)
+		NewAccountSubscription() (*AccountSubscription, error)
+		NewDailyVolumeSubscription() (*DailyVolumeSubscription, error)
+		SubscribeTicker() WSTickerChan
+		SubscribeOrder(code string) WSOrderOrTradeChan
+		UnsubscribeTicker()
+		UnsubscribeOrder(code string)
+		Unsubscribe(code string)
+		MonitorHeartbeat(timeout time.Duration)
+		LastMessageAge() (time.Duration, bool)
+		Close() error
+		Shutdown(ctx context.Context) error
+	}
+
+	//Client is the whole API, *Poloniex implements it and poloniexmock.Client is a mock of it,
+	//code that takes a Client (or just the part it uses) can be handed a fake or a decorator
+	Client interface {
+		PublicAPI
+		TradingAPI
+		LendingAPI
+		StreamAPI
+	}
+)
+
+var _ Client = (*Poloniex)(nil)
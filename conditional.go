@@ -0,0 +1,430 @@
+package poloniex
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+)
+
+type (
+	//ConditionKind is what makes a conditional order fire
+	ConditionKind string
+
+	//Condition is an order placed once the last price of Pair reaches a level. A sell StopLoss fires at or
+	//below Trigger and a sell TakeProfit at or above it, buys the other way round. A sell TrailingStop fires
+	//TrailBy below the highest price seen since it was added, a buy one TrailBy above the lowest.
+	//The order is an immediate-or-cancel limit order at the price that fired it worsened by MaxSlippage, a
+	//fraction, so it fills like a market order without sweeping the book or resting in it. OCO is the
+	//condition cancelled when this one fires.
+	Condition struct {
+		ID          int64
+		Pair        string
+		Side        string
+		Amount      ggm.Decimal
+		Kind        ConditionKind
+		Trigger     float64
+		TrailBy     float64
+		MaxSlippage float64
+		OCO         int64
+		// Extreme is the highest price seen by a sell TrailingStop and the lowest seen by a buy one
+		Extreme float64
+		Created time.Time
+	}
+
+	//ConditionEvent is a condition that fired, Err is set when its order couldn't be placed. Unfilled is
+	//what of the amount the book didn't fill within the slippage, it was cancelled.
+	ConditionEvent struct {
+		Condition   Condition
+		Price       float64
+		OrderNumber int64
+		Unfilled    ggm.Decimal
+		Err         error
+	}
+
+	//ConditionStore keeps the pending conditions across restarts
+	ConditionStore interface {
+		Load() ([]Condition, error)
+		Save(conditions []Condition) error
+	}
+
+	//FileConditionStore keeps the pending conditions in a JSON file
+	FileConditionStore string
+
+	//ConditionalOrders watches the websocket ticker and places the orders of conditions that fire,
+	//the events are sent over C until Stop. A condition fires once, also when its order fails.
+	//The store is saved at once when conditions are added, cancelled or fire, moves of the extreme
+	//of trailing stops alone at most every ExtremeSaveInterval and on Stop.
+	ConditionalOrders struct {
+		C chan ConditionEvent
+
+		p          *Poloniex
+		store      ConditionStore
+		mu         sync.Mutex
+		conditions map[int64]*Condition
+		next       int64
+		pending    []ConditionEvent
+		saved      time.Time
+		dirty      bool
+		wake       chan struct{}
+		sub        *TickerSubscription
+		trades     []*OrderSubscription
+		stop       chan struct{}
+		stopOnce   sync.Once
+		wg         sync.WaitGroup
+	}
+)
+
+// ExtremeSaveInterval is the least time between two saves of the store for moves of trailing stops
+const ExtremeSaveInterval = 5 * time.Second
+
+const (
+	// StopLoss fires when the price moves against the position, a sell at or below Trigger
+	StopLoss ConditionKind = "stop_loss"
+	// TakeProfit fires when the price moves in favor of the position, a sell at or above Trigger
+	TakeProfit ConditionKind = "take_profit"
+	// TrailingStop is a stop loss following the price at a distance of TrailBy
+	TrailingStop ConditionKind = "trailing_stop"
+)
+
+// Load implements ConditionStore, a missing file holds no conditions
+func (f FileConditionStore) Load() ([]Condition, error) {
+	b, err := ioutil.ReadFile(string(f))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading conditions failed")
+	}
+	conditions := []Condition{}
+	if err := json.Unmarshal(b, &conditions); err != nil {
+		return nil, errors.Wrap(err, "decoding conditions failed")
+	}
+	return conditions, nil
+}
+
+// Save implements ConditionStore, the file is replaced in one step so a crash leaves the old or the new one
+func (f FileConditionStore) Save(conditions []Condition) error {
+	b, err := json.MarshalIndent(conditions, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(string(f)), filepath.Base(string(f))+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "saving conditions failed")
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "saving conditions failed")
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "saving conditions failed")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), string(f)), "saving conditions failed")
+}
+
+// NewConditionalOrders loads the pending conditions from store, nil for none kept, and starts watching the ticker
+func (p *Poloniex) NewConditionalOrders(store ConditionStore) (*ConditionalOrders, error) {
+	c := &ConditionalOrders{
+		C:          make(chan ConditionEvent),
+		p:          p,
+		store:      store,
+		conditions: map[int64]*Condition{},
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+	if store != nil {
+		loaded, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		for i := range loaded {
+			cond := loaded[i]
+			c.conditions[cond.ID] = &cond
+			if cond.ID > c.next {
+				c.next = cond.ID
+			}
+		}
+	}
+	sub, err := p.NewTickerSubscription()
+	if err != nil {
+		return nil, err
+	}
+	c.sub = sub
+	c.wg.Add(2)
+	go c.watch()
+	go c.deliver()
+	return c, nil
+}
+
+// Stop ends watching and closes C, the pending conditions stay in the store
+func (c *ConditionalOrders) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		c.sub.Close()
+		c.mu.Lock()
+		for _, t := range c.trades {
+			t.Close()
+		}
+		c.mu.Unlock()
+		c.wg.Wait()
+		close(c.C)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.dirty {
+			if err := c.save(); err != nil {
+				c.p.log().Error("saving conditions failed", "error", err)
+			}
+		}
+	})
+}
+
+// WatchTrades also checks the conditions of pair against its trades, which follow the market closer than the ticker
+func (c *ConditionalOrders) WatchTrades(pair string) error {
+	sub, err := c.p.NewOrderSubscription(pair)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.trades = append(c.trades, sub)
+	c.mu.Unlock()
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for o := range sub.C {
+			for _, v := range o.Orders {
+				if v.Type == "newTrade" {
+					c.Check(pair, toFloat(v.Data.Rate))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Add adds a condition and returns its ID
+func (c *ConditionalOrders) Add(cond Condition) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.add(&cond); err != nil {
+		return 0, err
+	}
+	return cond.ID, c.save()
+}
+
+// AddOCO adds two conditions of which the first to fire cancels the other, e.g. a stop loss and a take profit
+func (c *ConditionalOrders) AddOCO(a, b Condition) (idA, idB int64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = c.add(&a); err != nil {
+		return
+	}
+	if err = c.add(&b); err != nil {
+		delete(c.conditions, a.ID)
+		return
+	}
+	c.conditions[a.ID].OCO, c.conditions[b.ID].OCO = b.ID, a.ID
+	return a.ID, b.ID, c.save()
+}
+
+// Cancel removes a pending condition, the other one of an OCO pair stays
+func (c *ConditionalOrders) Cancel(id int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cond, ok := c.conditions[id]
+	if !ok {
+		return errors.Errorf("no pending condition %d", id)
+	}
+	if other, ok := c.conditions[cond.OCO]; ok {
+		other.OCO = 0
+	}
+	delete(c.conditions, id)
+	return c.save()
+}
+
+// Pending returns the conditions that didn't fire yet by ID
+func (c *ConditionalOrders) Pending() []Condition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.list()
+}
+
+// Check applies a price of pair to the conditions, the ticker does so for every last price, a trade feed can too
+func (c *ConditionalOrders) Check(pair string, price float64) {
+	c.mu.Lock()
+	fired := []Condition{}
+	moved := false
+	for _, cond := range c.list() {
+		if cond.Pair != pair {
+			continue
+		}
+		if _, ok := c.conditions[cond.ID]; !ok {
+			// cancelled as the other one of an OCO pair that fired
+			continue
+		}
+		fire, extreme := cond.check(price)
+		if extreme {
+			c.conditions[cond.ID].Extreme = cond.Extreme
+			moved = true
+		}
+		if !fire {
+			continue
+		}
+		fired = append(fired, cond)
+		delete(c.conditions, cond.ID)
+		delete(c.conditions, cond.OCO)
+	}
+	if moved {
+		c.dirty = true
+	}
+	if len(fired) > 0 || (c.dirty && time.Since(c.saved) >= ExtremeSaveInterval) {
+		if err := c.save(); err != nil {
+			c.p.log().Error("saving conditions failed", "error", err)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, cond := range fired {
+		e := ConditionEvent{Condition: cond, Price: price}
+		e.OrderNumber, e.Unfilled, e.Err = c.place(cond, price)
+		c.p.log().Info("condition fired", "id", cond.ID, "pair", cond.Pair, "kind", cond.Kind, "price", price, "order", e.OrderNumber,
+			"unfilled", e.Unfilled.String(), "error", e.Err)
+		c.mu.Lock()
+		c.pending = append(c.pending, e)
+		c.mu.Unlock()
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// check reports whether cond fires at price and whether a trailing stop moved its extreme
+func (cond *Condition) check(price float64) (fire, moved bool) {
+	sell := cond.Side == "sell"
+	switch cond.Kind {
+	case StopLoss:
+		return (sell && price <= cond.Trigger) || (!sell && price >= cond.Trigger), false
+	case TakeProfit:
+		return (sell && price >= cond.Trigger) || (!sell && price <= cond.Trigger), false
+	case TrailingStop:
+		if cond.Extreme == 0 || (sell && price > cond.Extreme) || (!sell && price < cond.Extreme) {
+			cond.Extreme, moved = price, true
+		}
+		if sell {
+			return price <= cond.Extreme-cond.TrailBy, moved
+		}
+		return price >= cond.Extreme+cond.TrailBy, moved
+	}
+	return false, false
+}
+
+// place sends the immediate-or-cancel order of a fired condition at price worsened by its slippage cap
+func (c *ConditionalOrders) place(cond Condition, price float64) (number int64, unfilled ggm.Decimal, err error) {
+	rate := toDecimal(math.Round(price*(1-cond.MaxSlippage)*1e8) / 1e8)
+	if cond.Side == "buy" {
+		rate = toDecimal(math.Round(price*(1+cond.MaxSlippage)*1e8) / 1e8)
+	}
+	o := iocOrder{}
+	if err = c.p.place(context.Background(), cond.Side, cond.Pair, rate, cond.Amount, url.Values{"immediateOrCancel": {"1"}}, &o, &o.Buy); err != nil {
+		return
+	}
+	unfilled = toDecimal(0)
+	if o.AmountUnfilled != nil {
+		unfilled = *o.AmountUnfilled
+	}
+	return o.OrderNumber, unfilled, nil
+}
+
+func (c *ConditionalOrders) add(cond *Condition) error {
+	if cond.Side != "buy" && cond.Side != "sell" {
+		return errors.Errorf("invalid side %q", cond.Side)
+	}
+	switch cond.Kind {
+	case StopLoss, TakeProfit:
+		if cond.Trigger <= 0 {
+			return errors.New(string(cond.Kind) + " needs a trigger price")
+		}
+	case TrailingStop:
+		if cond.TrailBy <= 0 {
+			return errors.New("trailing stop needs a distance to trail by")
+		}
+	default:
+		return errors.Errorf("invalid condition kind %q", cond.Kind)
+	}
+	if toFloat(cond.Amount) <= 0 {
+		return errors.New("condition needs a positive amount")
+	}
+	c.next++
+	cond.ID = c.next
+	cond.OCO = 0
+	if cond.Created.IsZero() {
+		cond.Created = time.Now()
+	}
+	stored := *cond
+	c.conditions[cond.ID] = &stored
+	return nil
+}
+
+// list returns the pending conditions by ID, c.mu is held
+func (c *ConditionalOrders) list() []Condition {
+	list := make([]Condition, 0, len(c.conditions))
+	for _, cond := range c.conditions {
+		list = append(list, *cond)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// save writes the pending conditions to the store, c.mu is held
+func (c *ConditionalOrders) save() error {
+	if c.store == nil {
+		return nil
+	}
+	if err := c.store.Save(c.list()); err != nil {
+		return err
+	}
+	c.saved, c.dirty = time.Now(), false
+	return nil
+}
+
+func (c *ConditionalOrders) watch() {
+	defer c.wg.Done()
+	for t := range c.sub.C {
+		c.Check(t.Pair, toFloat(t.Last))
+	}
+}
+
+// deliver sends the queued events over C without holding up the ticker on slow readers
+func (c *ConditionalOrders) deliver() {
+	defer c.wg.Done()
+	for {
+		c.mu.Lock()
+		events := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		for _, e := range events {
+			select {
+			case c.C <- e:
+			case <-c.stop:
+				return
+			}
+		}
+		select {
+		case <-c.wake:
+		case <-c.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package poloniex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	//Credentials are the API key and secret of an account
+	Credentials struct {
+		Key    string `json:"key" yaml:"key"`
+		Secret string `json:"secret" yaml:"secret"`
+	}
+
+	//CredentialsProvider supplies the credentials of a client, it is asked again by RefreshCredentials
+	CredentialsProvider interface {
+		Credentials() (Credentials, error)
+	}
+
+	//CredentialsFunc adapts a function, e.g. a lookup in an external secret store, to a CredentialsProvider
+	CredentialsFunc func() (Credentials, error)
+
+	envCredentials struct {
+		keyVar, secretVar string
+	}
+
+	fileCredentials struct {
+		path string
+	}
+
+	secretFileCredentials struct {
+		keyPath, secretPath string
+	}
+)
+
+const (
+	// KeyEnv is the environment variable EnvCredentials reads the key from by default
+	KeyEnv = "POLONIEX_KEY"
+	// SecretEnv is the environment variable EnvCredentials reads the secret from by default
+	SecretEnv = "POLONIEX_SECRET"
+)
+
+// Credentials calls f
+func (f CredentialsFunc) Credentials() (Credentials, error) {
+	return f()
+}
+
+// EnvCredentials reads the key and secret from environment variables, KeyEnv and SecretEnv when left empty
+func EnvCredentials(keyVar, secretVar string) CredentialsProvider {
+	if keyVar == "" {
+		keyVar = KeyEnv
+	}
+	if secretVar == "" {
+		secretVar = SecretEnv
+	}
+	return envCredentials{keyVar, secretVar}
+}
+
+func (e envCredentials) Credentials() (Credentials, error) {
+	c := Credentials{Key: os.Getenv(e.keyVar), Secret: os.Getenv(e.secretVar)}
+	if c.Key == "" || c.Secret == "" {
+		return c, errors.New(e.keyVar + " and " + e.secretVar + " must both be set")
+	}
+	return c, nil
+}
+
+// FileCredentials reads the key and secret from a YAML file if path ends in .yaml or .yml and from a JSON file
+// otherwise, both with the fields of config-example.json. The file must not be accessible by other users.
+func FileCredentials(path string) CredentialsProvider {
+	return fileCredentials{path}
+}
+
+func (f fileCredentials) Credentials() (c Credentials, err error) {
+	b, err := readSecretFile(f.path)
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(filepath.Ext(f.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &c)
+	default:
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil {
+		return c, errors.Wrap(err, "unmarshal of credentials "+f.path+" failed")
+	}
+	if c.Key == "" || c.Secret == "" {
+		return c, errors.New("credentials " + f.path + " lack the key or the secret")
+	}
+	return c, nil
+}
+
+// SecretFileCredentials reads the key and the secret from a file each, as mounted by e.g. Docker or Kubernetes
+// secrets. Surrounding whitespace is ignored, the files must not be accessible by other users.
+func SecretFileCredentials(keyPath, secretPath string) CredentialsProvider {
+	return secretFileCredentials{keyPath, secretPath}
+}
+
+func (s secretFileCredentials) Credentials() (c Credentials, err error) {
+	key, err := readSecretFile(s.keyPath)
+	if err != nil {
+		return
+	}
+	secret, err := readSecretFile(s.secretPath)
+	if err != nil {
+		return
+	}
+	c = Credentials{Key: strings.TrimSpace(string(key)), Secret: strings.TrimSpace(string(secret))}
+	if c.Key == "" || c.Secret == "" {
+		return c, errors.New("empty key or secret in " + s.keyPath + " or " + s.secretPath)
+	}
+	return c, nil
+}
+
+// readSecretFile reads a file holding credentials, refusing it if group or others may access it
+func readSecretFile(path string) ([]byte, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading "+path+" failed")
+	}
+	// windows has no permission bits to go by
+	if mode := fi.Mode().Perm(); runtime.GOOS != "windows" && mode&0077 != 0 {
+		return nil, errors.New(path + " is accessible by other users (mode 0" + strconv.FormatUint(uint64(mode), 8) + "), restrict it to 0600")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading "+path+" failed")
+	}
+	return b, nil
+}
+
+// NewWithCredentialsProvider creates a client with the credentials of cp, RefreshCredentials asks cp again
+func NewWithCredentialsProvider(cp CredentialsProvider) (*Poloniex, error) {
+	p := NewPublicOnly()
+	if err := p.UseCredentialsProvider(cp); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UseCredentialsProvider switches the client to the credentials of cp
+func (p *Poloniex) UseCredentialsProvider(cp CredentialsProvider) error {
+	c, err := cp.Credentials()
+	if err != nil {
+		return errors.Wrap(err, "loading credentials failed")
+	}
+	p.mutex.Lock()
+	p.credentials = cp
+	p.mutex.Unlock()
+	p.SetCredentials(c)
+	return nil
+}
+
+// RefreshCredentials asks the provider of the client for its credentials again and switches to them,
+// e.g. after the key was rotated. Calls in flight finish with the old credentials.
+func (p *Poloniex) RefreshCredentials() error {
+	p.mutex.Lock()
+	cp := p.credentials
+	p.mutex.Unlock()
+	if cp == nil {
+		return errors.New("no credentials provider")
+	}
+	c, err := cp.Credentials()
+	if err != nil {
+		return errors.Wrap(err, "refreshing credentials failed")
+	}
+	p.SetCredentials(c)
+	return nil
+}
+
+// SetCredentials switches the client to c, safe to call while other calls are in flight. It doesn't wait
+// for them, calls signed before the switch finish with the old credentials.
+func (p *Poloniex) SetCredentials(c Credentials) {
+	p.credMutex.Lock()
+	defer p.credMutex.Unlock()
+	p.Key = c.Key
+	p.Secret = c.Secret
+}
+
+// keys returns the key and the secret to sign a call with
+func (p *Poloniex) keys() (key, secret string) {
+	p.credMutex.RLock()
+	defer p.credMutex.RUnlock()
+	return p.Key, p.Secret
+}
@@ -0,0 +1,46 @@
+package poloniex
+
+import (
+	"math/big"
+	"strconv"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api/internal/sim"
+)
+
+// toFloat is d as a float64 for prices compared and scaled loosely, 0 when d is empty
+func toFloat(d ggm.Decimal) float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// toDecimal is f rounded to 8 decimals
+func toDecimal(f float64) ggm.Decimal {
+	d, _ := ggm.NewDecimalFromString(sim.F8(f))
+	return d
+}
+
+// toRat is d as an exact fraction to add and multiply without float rounding, zero when d is empty
+func toRat(d ggm.Decimal) *big.Rat {
+	r, ok := new(big.Rat).SetString(d.String())
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+// ratDecimal is r with precision decimals, rounded half away from zero
+func ratDecimal(r *big.Rat, precision int) ggm.Decimal {
+	d, _ := ggm.NewDecimalFromString(r.FloatString(precision))
+	return d
+}
+
+// truncRat is positive r cut off to precision decimals, or rounded up to them if up is set
+func truncRat(r *big.Rat, precision int, up bool) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	units, rest := new(big.Int).QuoRem(new(big.Int).Mul(r.Num(), scale), r.Denom(), new(big.Int))
+	if up && rest.Sign() != 0 {
+		units.Add(units, big.NewInt(1))
+	}
+	return new(big.Rat).SetFrac(units, scale)
+}
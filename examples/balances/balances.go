@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"log"
 
-	"gitlab.com/wmlph/poloniex-api"
+	"github.com/hhh0pE/poloniex-api"
 )
 
 func main() {
-	p := poloniex.New("config.json")
+	p, err := poloniex.NewFromConfigFile("config.json")
+	if err != nil {
+		log.Fatalln(err)
+	}
 	balances, err := p.Balances()
 	if err != nil {
 		log.Fatalln(err)
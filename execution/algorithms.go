@@ -0,0 +1,62 @@
+package execution
+
+import (
+	"math"
+	"time"
+)
+
+type (
+	// TWAP spreads the order evenly over Duration in Slices, each slice puts what the schedule is behind by
+	// in the book, so a slice that didn't fill is caught up on by the next
+	TWAP struct {
+		Duration time.Duration
+		Slices   int
+	}
+
+	// VWAP follows the traded volume of the market, keeping the fills at Participation of it, e.g. 0.1 for
+	// a tenth, so the average price tracks the volume weighted average of the market
+	VWAP struct {
+		Participation float64
+	}
+
+	// Iceberg shows at most DisplaySize of the order in the book at a time
+	Iceberg struct {
+		DisplaySize float64
+	}
+)
+
+// Working implements Algorithm
+func (t TWAP) Working(s State) float64 {
+	slices := t.Slices
+	if slices < 1 {
+		slices = 1
+	}
+	slice := t.Duration / time.Duration(slices)
+	done := slices
+	if slice > 0 {
+		done = int(s.Now.Sub(s.Start)/slice) + 1
+	}
+	if done > slices {
+		done = slices
+	}
+	return s.Amount*float64(done)/float64(slices) - s.Filled
+}
+
+// Volume implements Algorithm
+func (TWAP) Volume() bool { return false }
+
+// Working implements Algorithm
+func (v VWAP) Working(s State) float64 {
+	return math.Min(s.MarketVolume*v.Participation, s.Amount) - s.Filled
+}
+
+// Volume implements Algorithm
+func (VWAP) Volume() bool { return true }
+
+// Working implements Algorithm
+func (i Iceberg) Working(s State) float64 {
+	return math.Min(i.DisplaySize, s.Amount-s.Filled)
+}
+
+// Volume implements Algorithm
+func (Iceberg) Volume() bool { return false }
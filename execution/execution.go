@@ -0,0 +1,361 @@
+// Package execution works a large parent order on Poloniex as a series of small passive child orders,
+// sliced by a TWAP schedule, by participation in the traded volume or by an iceberg display size.
+package execution
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Exchange is the part of the client the algorithms trade through, *poloniex.Poloniex implements it
+	Exchange interface {
+		OrderBook(pair string) (poloniex.OrderBook, error)
+		BuyPostOnly(pair string, rate, amount ggm.Decimal) (poloniex.Buy, error)
+		SellPostOnly(pair string, rate, amount ggm.Decimal) (poloniex.Sell, error)
+		MovePostOnly(orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error)
+		CancelOrder(orderNumber int64) (bool, error)
+		OrderTrades(orderNumber int64) (poloniex.OrderTrades, error)
+		NewOrderSubscription(code string) (*poloniex.OrderSubscription, error)
+	}
+
+	// Order is the parent order to execute, Side is "buy" or "sell"
+	Order struct {
+		Pair   string
+		Side   string
+		Amount ggm.Decimal
+	}
+
+	// Algorithm decides how much of the parent order a child order should be working at a moment
+	Algorithm interface {
+		// Working is the amount a child order should have in the book given the state of the execution,
+		// a child placed with less is replaced
+		Working(s State) float64
+		// Volume reports whether the algorithm needs the traded volume of the market in State
+		Volume() bool
+	}
+
+	// State is what an Algorithm decides on
+	State struct {
+		Start  time.Time
+		Now    time.Time
+		Amount float64
+		Filled float64
+		// MarketVolume is the amount the market traded since Start, only counted when the algorithm asks for it
+		MarketVolume float64
+	}
+
+	// Config tunes an execution
+	Config struct {
+		// Interval between checks of fills and prices, a second by default
+		Interval time.Duration
+		// MinAmount is the smallest child order the exchange accepts, a remainder below it is left unfilled
+		MinAmount float64
+		// OnProgress is called after every check
+		OnProgress func(Progress)
+	}
+
+	// Progress of an execution. ArrivalPrice is the middle of the book at the start and Slippage how much
+	// worse than it the average fill price is, as a fraction of it, negative when better.
+	Progress struct {
+		Order        Order
+		Filled       float64
+		AvgPrice     float64
+		ArrivalPrice float64
+		Slippage     float64
+		Children     int
+		Done         bool
+	}
+
+	// child is the order working in the book, fills under the numbers it had before moves are booked as done
+	child struct {
+		number int64
+		rate   float64
+		amount float64
+		filled float64
+	}
+
+	execution struct {
+		ex       Exchange
+		order    Order
+		algo     Algorithm
+		config   Config
+		amount   float64
+		progress Progress
+		// doneAmount and doneTotal add up the fills of children no longer working
+		doneAmount, doneTotal float64
+		child                 *child
+		childTotal            float64
+
+		mu     sync.Mutex
+		volume float64
+	}
+)
+
+// Run works o with algorithm a until it is filled or ctx is done, when the working child order is cancelled
+func Run(ctx context.Context, ex Exchange, o Order, a Algorithm, c Config) (Progress, error) {
+	if o.Side != "buy" && o.Side != "sell" {
+		return Progress{}, errors.Errorf("invalid side %q", o.Side)
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	e := &execution{ex: ex, order: o, algo: a, config: c, amount: toFloat(o.Amount)}
+	e.progress.Order = o
+
+	book, err := ex.OrderBook(o.Pair)
+	if err != nil {
+		return e.progress, errors.Wrap(err, "fetching arrival price failed")
+	}
+	bid, ask, err := top(book)
+	if err != nil {
+		return e.progress, err
+	}
+	e.progress.ArrivalPrice = (bid + ask) / 2
+
+	if a.Volume() {
+		sub, err := ex.NewOrderSubscription(o.Pair)
+		if err != nil {
+			return e.progress, errors.Wrap(err, "subscribing to trades failed")
+		}
+		defer sub.Close()
+		go e.countVolume(sub)
+	}
+
+	start := time.Now()
+	tick := time.NewTicker(c.Interval)
+	defer tick.Stop()
+	for {
+		err := e.step(start, bid, ask)
+		if c.OnProgress != nil {
+			c.OnProgress(e.progress)
+		}
+		if err != nil || e.progress.Done {
+			return e.progress, err
+		}
+		select {
+		case <-ctx.Done():
+			return e.progress, e.stop()
+		case <-tick.C:
+		}
+		book, err := ex.OrderBook(o.Pair)
+		if err != nil {
+			return e.progress, e.abort(errors.Wrap(err, "fetching order book failed"))
+		}
+		if bid, ask, err = top(book); err != nil {
+			return e.progress, e.abort(err)
+		}
+	}
+}
+
+// countVolume adds up the trades of the market from the websocket
+func (e *execution) countVolume(sub *poloniex.OrderSubscription) {
+	for o := range sub.C {
+		for _, v := range o.Orders {
+			if v.Type == "newTrade" {
+				e.mu.Lock()
+				e.volume += toFloat(v.Data.Amount)
+				e.mu.Unlock()
+			}
+		}
+	}
+}
+
+// step brings the working child in line with the algorithm and the book
+func (e *execution) step(start time.Time, bid, ask float64) error {
+	if err := e.fills(); err != nil {
+		return e.abort(err)
+	}
+	remaining := e.amount - e.filled()
+	if remaining < e.config.MinAmount || remaining <= 1e-9 {
+		e.progress.Done = true
+		return e.stop()
+	}
+
+	e.mu.Lock()
+	volume := e.volume
+	e.mu.Unlock()
+	want := math.Min(e.algo.Working(State{Start: start, Now: time.Now(), Amount: e.amount, Filled: e.filled(), MarketVolume: volume}), remaining)
+	want = math.Floor(want*1e8) / 1e8
+
+	// passive: join the best bid when buying and the best ask when selling
+	rate := bid
+	if e.order.Side == "sell" {
+		rate = ask
+	}
+
+	if c := e.child; c != nil {
+		if want > c.amount+1e-9 {
+			// the algorithm wants more in the book than the child was placed with, a child that was
+			// partially filled is left working until it is filled or the algorithm wants more
+			if err := e.retire(); err != nil {
+				return e.abort(err)
+			}
+		} else if c.rate != rate {
+			return e.move(rate)
+		} else {
+			return nil
+		}
+	}
+	if want < e.config.MinAmount || want <= 0 {
+		return nil
+	}
+	return e.place(rate, want)
+}
+
+func (e *execution) place(rate, amount float64) (err error) {
+	var o poloniex.Buy
+	if e.order.Side == "buy" {
+		o, err = e.ex.BuyPostOnly(e.order.Pair, toDecimal(rate), toDecimal(amount))
+	} else {
+		var s poloniex.Sell
+		s, err = e.ex.SellPostOnly(e.order.Pair, toDecimal(rate), toDecimal(amount))
+		o = s.Buy
+	}
+	if err != nil {
+		if errors.Is(err, &poloniex.APIError{Kind: poloniex.ErrorRejected}) {
+			// the book moved into the rate, try again at the next check
+			return nil
+		}
+		return e.abort(errors.Wrap(err, "placing child order failed"))
+	}
+	e.child = &child{number: o.OrderNumber, rate: rate, amount: amount}
+	e.progress.Children++
+	return nil
+}
+
+// move re-prices the working child, the fills under its old number are kept in done
+func (e *execution) move(rate float64) error {
+	c := e.child
+	m, err := e.ex.MovePostOnly(c.number, toDecimal(rate))
+	if err == nil && m.Success != 1 {
+		// filled or cancelled meanwhile, the next check finds out
+		return nil
+	}
+	if err != nil {
+		if errors.Is(err, &poloniex.APIError{Kind: poloniex.ErrorRejected}) || errors.Is(err, &poloniex.APIError{Kind: poloniex.ErrorUnknownOrder}) {
+			return nil
+		}
+		return e.abort(errors.Wrap(err, "moving child order failed"))
+	}
+	if err := e.childFills(); err != nil {
+		return e.abort(err)
+	}
+	e.book()
+	e.child = &child{number: m.OrderNumber, rate: rate, amount: c.amount - c.filled}
+	return nil
+}
+
+// retire cancels the working child and books its fills
+func (e *execution) retire() error {
+	c := e.child
+	if _, err := e.ex.CancelOrder(c.number); err != nil && !errors.Is(err, &poloniex.APIError{Kind: poloniex.ErrorUnknownOrder}) {
+		return errors.Wrap(err, "cancelling child order failed")
+	}
+	if err := e.childFills(); err != nil {
+		return err
+	}
+	e.book()
+	return nil
+}
+
+// childFills fetches the fills of the working child
+func (e *execution) childFills() error {
+	c := e.child
+	trades, err := e.ex.OrderTrades(c.number)
+	if err != nil && !errors.Is(err, &poloniex.APIError{Kind: poloniex.ErrorUnknownOrder}) {
+		return errors.Wrap(err, "fetching fills failed")
+	}
+	c.filled, e.childTotal = 0, 0
+	for _, t := range trades {
+		c.filled += toFloat(t.Amount)
+		e.childTotal += toFloat(t.Amount) * toFloat(t.Rate)
+	}
+	return nil
+}
+
+// book moves the fills of the working child to the done ones, the child stops working
+func (e *execution) book() {
+	e.doneAmount += e.child.filled
+	e.doneTotal += e.childTotal
+	e.child, e.childTotal = nil, 0
+}
+
+// fills updates the fills of the working child and the progress
+func (e *execution) fills() error {
+	if c := e.child; c != nil {
+		if err := e.childFills(); err != nil {
+			return err
+		}
+		if c.filled >= c.amount-1e-9 {
+			e.book()
+		}
+	}
+	p := &e.progress
+	p.Filled = e.filled()
+	if p.Filled > 0 {
+		p.AvgPrice = (e.doneTotal + e.childTotal) / p.Filled
+		p.Slippage = (p.AvgPrice - p.ArrivalPrice) / p.ArrivalPrice
+		if e.order.Side == "sell" {
+			p.Slippage = -p.Slippage
+		}
+	}
+	return nil
+}
+
+func (e *execution) filled() float64 {
+	f := e.doneAmount
+	if e.child != nil {
+		f += e.child.filled
+	}
+	return f
+}
+
+// stop cancels the working child
+func (e *execution) stop() error {
+	if e.child == nil {
+		return nil
+	}
+	if err := e.retire(); err != nil {
+		return err
+	}
+	e.progress.Filled = e.filled()
+	return nil
+}
+
+// abort cancels the working child on the way out of a failed execution
+func (e *execution) abort(err error) error {
+	if e.child != nil {
+		if _, cerr := e.ex.CancelOrder(e.child.number); cerr == nil {
+			e.child = nil
+		}
+	}
+	return err
+}
+
+func top(book poloniex.OrderBook) (bid, ask float64, err error) {
+	if book.IsFrozen {
+		return 0, 0, errors.New("market is frozen")
+	}
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return 0, 0, errors.New("order book is empty")
+	}
+	return toFloat(book.Bids[0].Rate), toFloat(book.Asks[0].Rate), nil
+}
+
+func toFloat(d ggm.Decimal) float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+func toDecimal(f float64) ggm.Decimal {
+	d, _ := ggm.NewDecimalFromString(strconv.FormatFloat(f, 'f', 8, 64))
+	return d
+}
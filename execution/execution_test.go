@@ -0,0 +1,82 @@
+package execution
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api"
+	"github.com/hhh0pE/poloniex-api/poloniextest"
+)
+
+var _ Exchange = (*poloniex.Poloniex)(nil)
+
+func d(s string) ggm.Decimal {
+	v, err := ggm.NewDecimalFromString(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestAlgorithms(t *testing.T) {
+	start := time.Unix(0, 0)
+	twap := TWAP{Duration: 10 * time.Minute, Slices: 5}
+	for _, c := range []struct {
+		at             time.Duration
+		filled, expect float64
+	}{{0, 0, 2}, {time.Minute, 1, 1}, {4 * time.Minute, 1, 5}, {time.Hour, 9, 1}} {
+		if w := twap.Working(State{Start: start, Now: start.Add(c.at), Amount: 10, Filled: c.filled}); w != c.expect {
+			t.Errorf("TWAP at %v with %v filled works %v, not %v", c.at, c.filled, w, c.expect)
+		}
+	}
+	if w := (VWAP{Participation: 0.1}).Working(State{Amount: 10, Filled: 1, MarketVolume: 50}); w != 4 {
+		t.Errorf("VWAP works %v", w)
+	}
+	if w := (Iceberg{DisplaySize: 2}).Working(State{Amount: 10, Filled: 9}); w != 1 {
+		t.Errorf("iceberg works %v", w)
+	}
+}
+
+func TestIceberg(t *testing.T) {
+	srv := poloniextest.NewServer()
+	defer srv.Close()
+	p := poloniex.NewWithCredentials(srv.Key, srv.Secret)
+	p.UseEndpoints(poloniex.Endpoints{Public: srv.PublicURL, Private: srv.PrivateURL, WS: srv.WSURL, Push: srv.PushURL})
+	srv.SetBalance("BTC", 1)
+	srv.SetOrderBook("BTC_ETH",
+		[]poloniextest.Level{{Rate: 0.031, Amount: 10}},
+		[]poloniextest.Level{{Rate: 0.030, Amount: 10}})
+
+	// someone sells into the bids every few milliseconds, the book moves up once
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		for i := 0; ctx.Err() == nil; i++ {
+			time.Sleep(15 * time.Millisecond)
+			if i == 3 {
+				srv.SetOrderBook("BTC_ETH",
+					[]poloniextest.Level{{Rate: 0.031, Amount: 10}},
+					[]poloniextest.Level{{Rate: 0.0302, Amount: 10}})
+			}
+			srv.Trade("BTC_ETH", "buy", 0.030, 0.4)
+		}
+	}()
+
+	progress, err := Run(ctx, p, Order{Pair: "BTC_ETH", Side: "buy", Amount: d("2.5")}, Iceberg{DisplaySize: 1}, Config{Interval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !progress.Done || math.Abs(progress.Filled-2.5) > 1e-9 || progress.Children < 3 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+	if progress.ArrivalPrice != 0.0305 || progress.AvgPrice < 0.030 || progress.AvgPrice > 0.0302 || progress.Slippage >= 0 {
+		t.Errorf("unexpected prices %+v", progress)
+	}
+	open, err := p.OpenOrders("BTC_ETH")
+	if err != nil || len(open) != 0 {
+		t.Errorf("orders left in the book %+v %v", open, err)
+	}
+}
@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Commands are the trading API commands Command answers
+var Commands = map[string]bool{
+	"returnBalances":                 true,
+	"returnCompleteBalances":         true,
+	"returnAvailableAccountBalances": true,
+	"returnFeeInfo":                  true,
+	"returnOpenOrders":               true,
+	"returnTradeHistory":             true,
+	"returnOrderTrades":              true,
+	"buy":                            true,
+	"sell":                           true,
+	"cancelOrder":                    true,
+	"moveOrder":                      true,
+}
+
+// Command answers a trading API command with the value Poloniex would return as JSON
+func (e *Exchange) Command(form url.Values) interface{} {
+	pair := form.Get("currencyPair")
+	number, _ := strconv.ParseInt(form.Get("orderNumber"), 10, 64)
+	rate, _ := strconv.ParseFloat(form.Get("rate"), 64)
+	amount, _ := strconv.ParseFloat(form.Get("amount"), 64)
+	opts := Options{
+		PostOnly:          form.Get("postOnly") == "1",
+		ImmediateOrCancel: form.Get("immediateOrCancel") == "1",
+		FillOrKill:        form.Get("fillOrKill") == "1",
+	}
+
+	switch form.Get("command") {
+	case "returnBalances":
+		balances := map[string]string{}
+		for c, b := range e.Balances() {
+			balances[c] = F8(b.Available)
+		}
+		return balances
+	case "returnCompleteBalances":
+		balances := map[string]interface{}{}
+		for c, b := range e.Balances() {
+			balances[c] = map[string]string{"available": F8(b.Available), "onOrders": F8(b.OnOrders), "btcValue": F8(0)}
+		}
+		return balances
+	case "returnAvailableAccountBalances":
+		exchange := map[string]string{}
+		for c, b := range e.Balances() {
+			if b.Available > 0 {
+				exchange[c] = F8(b.Available)
+			}
+		}
+		return map[string]interface{}{"exchange": exchange}
+	case "returnFeeInfo":
+		return map[string]string{
+			"makerFee":        F8(e.MakerFee),
+			"takerFee":        F8(e.TakerFee),
+			"thirtyDayVolume": F8(0),
+			"nextTier":        F8(600000),
+		}
+	case "returnOpenOrders":
+		if pair == "all" {
+			all := map[string]interface{}{}
+			for _, p := range e.Pairs() {
+				all[p] = openOrders(e.OpenOrders(p))
+			}
+			return all
+		}
+		return openOrders(e.OpenOrders(pair))
+	case "returnTradeHistory":
+		if pair == "all" {
+			all := map[string]interface{}{}
+			for _, t := range e.Trades("") {
+				l, _ := all[t.Pair].([]map[string]interface{})
+				all[t.Pair] = append(l, privateTrade(t))
+			}
+			return all
+		}
+		trades := []map[string]interface{}{}
+		for _, t := range e.Trades(pair) {
+			trades = append(trades, privateTrade(t))
+		}
+		return trades
+	case "returnOrderTrades":
+		trades := []map[string]interface{}{}
+		for _, t := range e.OrderTrades(number) {
+			trades = append(trades, orderTrade(t))
+		}
+		if len(trades) == 0 {
+			return Error("Order not found, or you are not the person who placed it.")
+		}
+		return trades
+	case "buy", "sell":
+		side := Buy
+		if form.Get("command") == "sell" {
+			side = Sell
+		}
+		o, trades, err := e.Place(pair, side, rate, amount, opts)
+		if err != nil {
+			return Error(err.Error())
+		}
+		res := map[string]interface{}{"orderNumber": strconv.FormatInt(lastNumber(o, trades), 10), "resultingTrades": resultingTrades(trades)}
+		if opts.ImmediateOrCancel {
+			remaining := amount
+			for _, t := range trades {
+				remaining -= t.Amount
+			}
+			res["amountUnfilled"] = F8(Round(remaining))
+		}
+		return res
+	case "cancelOrder":
+		if err := e.Cancel(number); err != nil {
+			return map[string]interface{}{"success": 0, "error": err.Error()}
+		}
+		return map[string]interface{}{"success": 1}
+	case "moveOrder":
+		o, trades, err := e.Move(number, rate, amount, opts)
+		if err != nil {
+			return map[string]interface{}{"success": 0, "error": err.Error()}
+		}
+		return map[string]interface{}{
+			"success":         1,
+			"orderNumber":     strconv.FormatInt(o.Number, 10),
+			"resultingTrades": map[string]interface{}{o.Pair: resultingTrades(trades)},
+		}
+	}
+	return Error("Invalid command.")
+}
+
+// Error is the value Poloniex returns for a failed command
+func Error(msg string) map[string]string {
+	return map[string]string{"error": msg}
+}
+
+// F8 formats x with the 8 decimals Poloniex uses
+func F8(x float64) string {
+	return strconv.FormatFloat(x, 'f', 8, 64)
+}
+
+// DateFormat is the layout of dates in Poloniex responses
+const DateFormat = "2006-01-02 15:04:05"
+
+// lastNumber is the number of an order that may have been filled completely and isn't resting
+func lastNumber(o *Order, trades []Trade) int64 {
+	if o != nil {
+		return o.Number
+	}
+	if len(trades) > 0 {
+		return trades[0].OrderNumber
+	}
+	return 0
+}
+
+func openOrders(orders []Order) []map[string]interface{} {
+	out := []map[string]interface{}{}
+	for _, o := range orders {
+		out = append(out, map[string]interface{}{
+			"orderNumber":    strconv.FormatInt(o.Number, 10),
+			"type":           o.Side.String(),
+			"rate":           F8(o.Rate),
+			"startingAmount": F8(o.Original),
+			"amount":         F8(o.Amount),
+			"total":          F8(Round(o.Rate * o.Amount)),
+			"date":           o.Date.UTC().Format(DateFormat),
+		})
+	}
+	return out
+}
+
+func privateTrade(t Trade) map[string]interface{} {
+	return map[string]interface{}{
+		"globalTradeID": t.GlobalID,
+		"tradeID":       strconv.FormatInt(t.ID, 10),
+		"date":          t.Date.UTC().Format(DateFormat),
+		"rate":          F8(t.Rate),
+		"amount":        F8(t.Amount),
+		"total":         F8(t.Total),
+		"fee":           F8(t.Fee),
+		"orderNumber":   strconv.FormatInt(t.OrderNumber, 10),
+		"type":          t.Side.String(),
+		"category":      "exchange",
+	}
+}
+
+func orderTrade(t Trade) map[string]interface{} {
+	return map[string]interface{}{
+		"globalTradeID": t.GlobalID,
+		"tradeID":       t.ID,
+		"currencyPair":  t.Pair,
+		"type":          t.Side.String(),
+		"rate":          F8(t.Rate),
+		"amount":        F8(t.Amount),
+		"total":         F8(t.Total),
+		"fee":           F8(t.Fee),
+		"date":          t.Date.UTC().Format(DateFormat),
+	}
+}
+
+func resultingTrades(trades []Trade) []map[string]interface{} {
+	out := []map[string]interface{}{}
+	for _, t := range trades {
+		out = append(out, map[string]interface{}{
+			"amount":  F8(t.Amount),
+			"date":    t.Date.UTC().Format(DateFormat),
+			"rate":    F8(t.Rate),
+			"total":   F8(t.Total),
+			"tradeID": strconv.FormatInt(t.ID, 10),
+			"type":    t.Side.String(),
+		})
+	}
+	return out
+}
@@ -0,0 +1,475 @@
+// Package sim is an in-memory exchange with balances, resting orders and a matching engine,
+// it backs the fake server, paper trading and backtesting.
+package sim
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Side of an order
+type Side int
+
+const (
+	// Buy spends the base currency of a pair to get its quote currency
+	Buy Side = iota
+	// Sell spends the quote currency of a pair to get its base currency
+	Sell
+)
+
+func (s Side) String() string {
+	if s == Buy {
+		return "buy"
+	}
+	return "sell"
+}
+
+type (
+	// Level is a price level of an order book
+	Level struct {
+		Rate   float64
+		Amount float64
+	}
+
+	// Order is an order resting on the book
+	Order struct {
+		Number   int64
+		Pair     string
+		Side     Side
+		Rate     float64
+		Amount   float64
+		Original float64
+		Date     time.Time
+	}
+
+	// Trade is a fill of one of the account's orders
+	Trade struct {
+		GlobalID    int64
+		ID          int64
+		OrderNumber int64
+		Pair        string
+		Side        Side
+		Rate        float64
+		Amount      float64
+		Total       float64
+		Fee         float64
+		Maker       bool
+		Date        time.Time
+	}
+
+	// Balance of a currency
+	Balance struct {
+		Available float64
+		OnOrders  float64
+	}
+
+	// Options change how an order is matched
+	Options struct {
+		PostOnly          bool
+		ImmediateOrCancel bool
+		FillOrKill        bool
+	}
+
+	// Exchange is a single account trading against order books set from outside
+	Exchange struct {
+		MakerFee float64
+		TakerFee float64
+		// Now is the clock of the exchange, time.Now when nil
+		Now func() time.Time
+
+		mu        sync.Mutex
+		available map[string]float64
+		asks      map[string][]Level
+		bids      map[string][]Level
+		orders    map[int64]*Order
+		trades    []Trade
+		lastOrder int64
+		lastTrade int64
+	}
+)
+
+var (
+	// ErrNoOrder is returned for order numbers that aren't open
+	ErrNoOrder = errors.New("Invalid order number, or you are not the person who placed the order.")
+	// ErrPostOnly is returned when a post-only order would take liquidity
+	ErrPostOnly = errors.New("Unable to place post-only order at this price.")
+	// ErrFillOrKill is returned when a fill-or-kill order can't be filled completely
+	ErrFillOrKill = errors.New("Unable to fill order completely.")
+	// ErrAmount is returned for non-positive rates or amounts
+	ErrAmount = errors.New("Invalid rate or amount parameter.")
+)
+
+// New returns an exchange with Poloniex' default fees
+func New() *Exchange {
+	return &Exchange{
+		MakerFee:  0.0015,
+		TakerFee:  0.0025,
+		available: map[string]float64{},
+		asks:      map[string][]Level{},
+		bids:      map[string][]Level{},
+		orders:    map[int64]*Order{},
+		lastOrder: 100000000,
+		lastTrade: 100000000,
+	}
+}
+
+// Split returns the base and quote currency of a pair, "BTC_ETH" is traded at rates in BTC for amounts in ETH
+func Split(pair string) (base, quote string) {
+	i := strings.Index(pair, "_")
+	if i < 0 {
+		return pair, ""
+	}
+	return pair[:i], pair[i+1:]
+}
+
+// Round rounds x to the 8 decimals Poloniex works with
+func Round(x float64) float64 {
+	return math.Round(x*1e8) / 1e8
+}
+
+func (e *Exchange) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+// SetBalance sets the available amount of currency
+func (e *Exchange) SetBalance(currency string, amount float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.available[currency] = amount
+}
+
+// Balances returns the balance of every currency the account has held
+func (e *Exchange) Balances() map[string]Balance {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	b := map[string]Balance{}
+	for c, a := range e.available {
+		b[c] = Balance{Available: Round(a)}
+	}
+	for _, o := range e.orders {
+		c, amount := e.reserved(o)
+		v := b[c]
+		v.OnOrders = Round(v.OnOrders + amount)
+		b[c] = v
+	}
+	return b
+}
+
+// SetBook replaces the outside liquidity of pair, asks ascending and bids descending by rate
+func (e *Exchange) SetBook(pair string, asks, bids []Level) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.asks[pair] = append([]Level{}, asks...)
+	e.bids[pair] = append([]Level{}, bids...)
+	sort.Slice(e.asks[pair], func(i, j int) bool { return e.asks[pair][i].Rate < e.asks[pair][j].Rate })
+	sort.Slice(e.bids[pair], func(i, j int) bool { return e.bids[pair][i].Rate > e.bids[pair][j].Rate })
+}
+
+// Pairs returns every pair with a book or resting orders, sorted
+func (e *Exchange) Pairs() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	seen := map[string]bool{}
+	for p := range e.asks {
+		seen[p] = true
+	}
+	for p := range e.bids {
+		seen[p] = true
+	}
+	for _, o := range e.orders {
+		seen[o.Pair] = true
+	}
+	pairs := []string{}
+	for p := range seen {
+		pairs = append(pairs, p)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// Book returns the order book of pair, outside liquidity merged with the account's resting orders
+func (e *Exchange) Book(pair string) (asks, bids []Level) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	asks = append(asks, e.asks[pair]...)
+	bids = append(bids, e.bids[pair]...)
+	for _, o := range e.orders {
+		if o.Pair != pair {
+			continue
+		}
+		if o.Side == Sell {
+			asks = mergeLevel(asks, Level{o.Rate, o.Amount})
+		} else {
+			bids = mergeLevel(bids, Level{o.Rate, o.Amount})
+		}
+	}
+	sort.Slice(asks, func(i, j int) bool { return asks[i].Rate < asks[j].Rate })
+	sort.Slice(bids, func(i, j int) bool { return bids[i].Rate > bids[j].Rate })
+	return
+}
+
+func mergeLevel(levels []Level, l Level) []Level {
+	for i := range levels {
+		if levels[i].Rate == l.Rate {
+			levels[i].Amount = Round(levels[i].Amount + l.Amount)
+			return levels
+		}
+	}
+	return append(levels, l)
+}
+
+// Place matches a limit order against the outside liquidity of pair and rests what is left of it,
+// the resting order is nil when nothing is left
+func (e *Exchange) Place(pair string, side Side, rate, amount float64, opts Options) (*Order, []Trade, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.place(pair, side, rate, amount, opts)
+}
+
+func (e *Exchange) place(pair string, side Side, rate, amount float64, opts Options) (*Order, []Trade, error) {
+	if rate <= 0 || amount <= 0 {
+		return nil, nil, ErrAmount
+	}
+	base, quote := Split(pair)
+	spend, need := quote, amount
+	if side == Buy {
+		spend, need = base, Round(rate*amount)
+	}
+	if e.available[spend] < need {
+		return nil, nil, errors.New("Not enough " + spend + ".")
+	}
+
+	book := e.asks[pair]
+	crosses := func(l Level) bool { return l.Rate <= rate }
+	if side == Sell {
+		book = e.bids[pair]
+		crosses = func(l Level) bool { return l.Rate >= rate }
+	}
+	if opts.PostOnly && len(book) > 0 && crosses(book[0]) {
+		return nil, nil, ErrPostOnly
+	}
+	if opts.FillOrKill {
+		fillable := 0.0
+		for _, l := range book {
+			if !crosses(l) {
+				break
+			}
+			fillable += l.Amount
+		}
+		if fillable < amount {
+			return nil, nil, ErrFillOrKill
+		}
+	}
+
+	e.lastOrder++
+	o := &Order{Number: e.lastOrder, Pair: pair, Side: side, Rate: rate, Amount: amount, Original: amount, Date: e.now()}
+	trades := []Trade{}
+	for len(book) > 0 && o.Amount > 0 && crosses(book[0]) {
+		n := math.Min(book[0].Amount, o.Amount)
+		trades = append(trades, e.fill(o, book[0].Rate, n, false))
+		book[0].Amount = Round(book[0].Amount - n)
+		if book[0].Amount <= 0 {
+			book = book[1:]
+		}
+	}
+	if side == Buy {
+		e.asks[pair] = book
+	} else {
+		e.bids[pair] = book
+	}
+	if o.Amount <= 0 || opts.ImmediateOrCancel {
+		return nil, trades, nil
+	}
+	c, reserve := e.reserved(o)
+	e.available[c] = Round(e.available[c] - reserve)
+	e.orders[o.Number] = o
+	r := *o
+	return &r, trades, nil
+}
+
+// reserved is the currency and amount held by a resting order
+func (e *Exchange) reserved(o *Order) (string, float64) {
+	base, quote := Split(o.Pair)
+	if o.Side == Buy {
+		return base, Round(o.Rate * o.Amount)
+	}
+	return quote, o.Amount
+}
+
+// fill moves the funds of amount of o traded at rate, o is either resting (maker) or being placed (taker)
+func (e *Exchange) fill(o *Order, rate, amount float64, maker bool) Trade {
+	base, quote := Split(o.Pair)
+	fee := e.TakerFee
+	if maker {
+		fee = e.MakerFee
+	}
+	total := Round(rate * amount)
+	t := Trade{OrderNumber: o.Number, Pair: o.Pair, Side: o.Side, Rate: rate, Amount: amount, Total: total, Maker: maker, Date: e.now()}
+	if o.Side == Buy {
+		if maker {
+			// the reserve was taken at the order's rate
+			e.available[base] = Round(e.available[base] + Round(o.Rate*amount) - total)
+		} else {
+			e.available[base] = Round(e.available[base] - total)
+		}
+		t.Fee = Round(amount * fee)
+		e.available[quote] = Round(e.available[quote] + amount - t.Fee)
+	} else {
+		if !maker {
+			e.available[quote] = Round(e.available[quote] - amount)
+		}
+		t.Fee = Round(total * fee)
+		e.available[base] = Round(e.available[base] + total - t.Fee)
+	}
+	o.Amount = Round(o.Amount - amount)
+	e.lastTrade++
+	t.ID = e.lastTrade
+	t.GlobalID = e.lastTrade
+	e.trades = append(e.trades, t)
+	return t
+}
+
+// Trade reports a trade of amount at rate that took liquidity from side of the book of pair,
+// the account's resting orders on that side at or better than rate are filled as makers
+func (e *Exchange) Trade(pair string, side Side, rate, amount float64) []Trade {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	resting := []*Order{}
+	for _, o := range e.orders {
+		if o.Pair != pair || o.Side != side {
+			continue
+		}
+		if (side == Buy && o.Rate >= rate) || (side == Sell && o.Rate <= rate) {
+			resting = append(resting, o)
+		}
+	}
+	sort.Slice(resting, func(i, j int) bool {
+		if resting[i].Rate == resting[j].Rate {
+			return resting[i].Number < resting[j].Number
+		}
+		if side == Buy {
+			return resting[i].Rate > resting[j].Rate
+		}
+		return resting[i].Rate < resting[j].Rate
+	})
+	trades := []Trade{}
+	for _, o := range resting {
+		if amount <= 0 {
+			break
+		}
+		n := math.Min(o.Amount, amount)
+		trades = append(trades, e.fill(o, o.Rate, n, true))
+		amount = Round(amount - n)
+		if o.Amount <= 0 {
+			delete(e.orders, o.Number)
+		}
+	}
+	return trades
+}
+
+// Cancel removes a resting order and releases its funds
+func (e *Exchange) Cancel(number int64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cancel(number)
+}
+
+func (e *Exchange) cancel(number int64) error {
+	o, ok := e.orders[number]
+	if !ok {
+		return ErrNoOrder
+	}
+	c, reserve := e.reserved(o)
+	e.available[c] = Round(e.available[c] + reserve)
+	delete(e.orders, number)
+	return nil
+}
+
+// Move cancels a resting order and places what is left of it at rate under a new order number,
+// a zero amount keeps the remaining amount
+func (e *Exchange) Move(number int64, rate, amount float64, opts Options) (*Order, []Trade, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.orders[number]
+	if !ok {
+		return nil, nil, ErrNoOrder
+	}
+	old := *o
+	if amount <= 0 {
+		amount = o.Amount
+	}
+	if err := e.cancel(number); err != nil {
+		return nil, nil, err
+	}
+	n, trades, err := e.place(old.Pair, old.Side, rate, amount, opts)
+	if err != nil {
+		// put the original order back
+		c, reserve := e.reserved(&old)
+		e.available[c] = Round(e.available[c] - reserve)
+		e.orders[old.Number] = &old
+		return nil, nil, err
+	}
+	if n == nil {
+		// filled completely, report the number it would have rested under
+		n = &Order{Number: e.lastOrder, Pair: old.Pair, Side: old.Side, Rate: rate}
+	}
+	return n, trades, nil
+}
+
+// Order returns a resting order
+func (e *Exchange) Order(number int64) (Order, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.orders[number]
+	if !ok {
+		return Order{}, false
+	}
+	return *o, true
+}
+
+// OpenOrders returns the resting orders of pair, of every pair if pair is empty, oldest first
+func (e *Exchange) OpenOrders(pair string) []Order {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	orders := []Order{}
+	for _, o := range e.orders {
+		if pair == "" || o.Pair == pair {
+			orders = append(orders, *o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].Number < orders[j].Number })
+	return orders
+}
+
+// Trades returns the account's fills of pair, of every pair if pair is empty, newest first
+func (e *Exchange) Trades(pair string) []Trade {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	trades := []Trade{}
+	for i := len(e.trades) - 1; i >= 0; i-- {
+		if pair == "" || e.trades[i].Pair == pair {
+			trades = append(trades, e.trades[i])
+		}
+	}
+	return trades
+}
+
+// OrderTrades returns the fills of an order, oldest first
+func (e *Exchange) OrderTrades(number int64) []Trade {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	trades := []Trade{}
+	for _, t := range e.trades {
+		if t.OrderNumber == number {
+			trades = append(trades, t)
+		}
+	}
+	return trades
+}
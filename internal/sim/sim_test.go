@@ -0,0 +1,83 @@
+package sim
+
+import "testing"
+
+func TestPlaceCrossesAndRests(t *testing.T) {
+	e := New()
+	e.SetBalance("BTC", 1)
+	e.SetBook("BTC_ETH", []Level{{Rate: 0.032, Amount: 20}, {Rate: 0.031, Amount: 10}}, nil)
+
+	o, trades, err := e.Place("BTC_ETH", Buy, 0.031, 12, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 1 || trades[0].Rate != 0.031 || trades[0].Amount != 10 || trades[0].Maker {
+		t.Fatalf("unexpected trades %+v", trades)
+	}
+	if o == nil || o.Amount != 2 {
+		t.Fatalf("unexpected resting order %+v", o)
+	}
+	b := e.Balances()
+	if b["BTC"].Available != 0.628 || b["BTC"].OnOrders != 0.062 || b["ETH"].Available != 9.975 {
+		t.Errorf("unexpected balances %+v", b)
+	}
+
+	fills := e.Trade("BTC_ETH", Buy, 0.0305, 5)
+	if len(fills) != 1 || fills[0].Amount != 2 || !fills[0].Maker || fills[0].Fee != 0.003 {
+		t.Fatalf("unexpected fills %+v", fills)
+	}
+	if len(e.OpenOrders("")) != 0 {
+		t.Error("filled order still open")
+	}
+	if b := e.Balances(); b["BTC"].Available != 0.628 || b["BTC"].OnOrders != 0 || b["ETH"].Available != 11.972 {
+		t.Errorf("unexpected balances %+v", b)
+	}
+}
+
+func TestPlaceOptions(t *testing.T) {
+	e := New()
+	e.SetBalance("ETH", 10)
+	e.SetBook("BTC_ETH", nil, []Level{{Rate: 0.030, Amount: 1}})
+
+	if _, _, err := e.Place("BTC_ETH", Sell, 0.029, 2, Options{PostOnly: true}); err != ErrPostOnly {
+		t.Errorf("post-only order took liquidity: %v", err)
+	}
+	if _, _, err := e.Place("BTC_ETH", Sell, 0.029, 2, Options{FillOrKill: true}); err != ErrFillOrKill {
+		t.Errorf("fill-or-kill order filled partially: %v", err)
+	}
+	o, trades, err := e.Place("BTC_ETH", Sell, 0.029, 2, Options{ImmediateOrCancel: true})
+	if err != nil || o != nil || len(trades) != 1 {
+		t.Errorf("unexpected immediate-or-cancel result %+v %+v %v", o, trades, err)
+	}
+	if _, _, err := e.Place("BTC_ETH", Sell, 0.029, 20, Options{}); err == nil {
+		t.Error("order without funds accepted")
+	}
+}
+
+func TestMoveAndCancel(t *testing.T) {
+	e := New()
+	e.SetBalance("BTC", 1)
+	o, _, err := e.Place("BTC_ETH", Buy, 0.02, 10, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, err := e.Move(o.Number, 0.025, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Number == o.Number || m.Amount != 10 {
+		t.Errorf("unexpected moved order %+v", m)
+	}
+	if b := e.Balances(); b["BTC"].OnOrders != 0.25 {
+		t.Errorf("unexpected balances %+v", b)
+	}
+	if err := e.Cancel(o.Number); err != ErrNoOrder {
+		t.Errorf("moved order still open: %v", err)
+	}
+	if err := e.Cancel(m.Number); err != nil {
+		t.Fatal(err)
+	}
+	if b := e.Balances(); b["BTC"].Available != 1 || b["BTC"].OnOrders != 0 {
+		t.Errorf("unexpected balances %+v", b)
+	}
+}
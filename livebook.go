@@ -0,0 +1,180 @@
+package poloniex
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	//LiveOrderBook is the order book of a pair seeded from OrderBook and kept up to date from the
+	//orderBookModify and orderBookRemove events of the websocket order feed, it is fetched again
+	//whenever the sequence numbers of the feed skip. Done is closed when the book stops following the feed.
+	LiveOrderBook struct {
+		p       *Poloniex
+		pair    string
+		mu      sync.RWMutex
+		asks    map[float64]float64
+		bids    map[float64]float64
+		seq     int64
+		frozen  bool
+		sub     *OrderSubscription
+		updated chan struct{}
+		done    chan struct{}
+		closed  bool
+		err     error
+	}
+)
+
+// NewLiveOrderBook subscribes to the order feed of pair and seeds the book from OrderBook, Close it when done
+func (p *Poloniex) NewLiveOrderBook(pair string) (*LiveOrderBook, error) {
+	b := &LiveOrderBook{p: p, pair: pair, updated: make(chan struct{}, 1), done: make(chan struct{})}
+	sub, err := p.NewOrderSubscription(pair)
+	if err != nil {
+		return nil, err
+	}
+	b.sub = sub
+	if err := b.resync(); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	go b.run()
+	return b, nil
+}
+
+// Best returns the highest bid and lowest ask, ok is false when a side is empty
+func (b *LiveOrderBook) Best() (bid, ask Order, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	bids, asks := sortedLevels(b.bids, true), sortedLevels(b.asks, false)
+	if len(bids) == 0 || len(asks) == 0 {
+		return Order{}, Order{}, false
+	}
+	return bids[0], asks[0], true
+}
+
+// OrderBook returns a copy of the book, best levels first
+func (b *LiveOrderBook) OrderBook() OrderBook {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return OrderBook{Asks: sortedLevels(b.asks, false), Bids: sortedLevels(b.bids, true), IsFrozen: b.frozen}
+}
+
+// Updated receives a value after the book changed, changes in between are coalesced
+func (b *LiveOrderBook) Updated() <-chan struct{} {
+	return b.updated
+}
+
+// Done is closed when the book stops following the feed, by Close or because the feed ended
+func (b *LiveOrderBook) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err is why the book stopped following the feed, nil while it follows it and after Close
+func (b *LiveOrderBook) Err() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.err
+}
+
+// Close ends the subscription of the book, it keeps its last state
+func (b *LiveOrderBook) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	err := b.sub.Close()
+	<-b.done
+	return err
+}
+
+func (b *LiveOrderBook) resync() error {
+	ob, err := b.p.OrderBook(b.pair)
+	if err != nil {
+		return err
+	}
+	asks, bids := map[float64]float64{}, map[float64]float64{}
+	for _, o := range ob.Asks {
+		asks[toFloat(o.Rate)] = toFloat(o.Amount)
+	}
+	for _, o := range ob.Bids {
+		bids[toFloat(o.Rate)] = toFloat(o.Amount)
+	}
+	b.mu.Lock()
+	b.asks, b.bids, b.frozen, b.seq = asks, bids, ob.IsFrozen, 0
+	b.mu.Unlock()
+	b.changed()
+	return nil
+}
+
+func (b *LiveOrderBook) run() {
+	defer close(b.done)
+	for o := range b.sub.C {
+		if b.apply(o) {
+			continue
+		}
+		b.p.log().Warn("order book feed skipped, fetching the book", "pair", b.pair, "seq", o.Seq)
+		if err := b.resync(); err != nil {
+			b.p.log().Error("fetching order book failed", "pair", b.pair, "error", err)
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.err = errors.New("order feed of " + b.pair + " closed")
+		b.p.log().Warn("live order book stopped", "pair", b.pair, "error", b.err)
+	}
+}
+
+// apply updates the book with the events of o, false when o doesn't follow the last message
+func (b *LiveOrderBook) apply(o WSOrderOrTrade) bool {
+	b.mu.Lock()
+	if o.Seq != SENTINEL {
+		if b.seq != 0 && o.Seq != b.seq+1 {
+			b.mu.Unlock()
+			return o.Seq <= b.seq
+		}
+		b.seq = o.Seq
+	}
+	for _, v := range o.Orders {
+		side := b.bids
+		if v.Data.Type == "ask" {
+			side = b.asks
+		}
+		rate := toFloat(v.Data.Rate)
+		switch v.Type {
+		case "orderBookModify":
+			side[rate] = toFloat(v.Data.Amount)
+		case "orderBookRemove":
+			delete(side, rate)
+		}
+	}
+	b.mu.Unlock()
+	b.changed()
+	return true
+}
+
+func (b *LiveOrderBook) changed() {
+	select {
+	case b.updated <- struct{}{}:
+	default:
+	}
+}
+
+func sortedLevels(levels map[float64]float64, descending bool) []Order {
+	rates := make([]float64, 0, len(levels))
+	for r, a := range levels {
+		if a > 0 {
+			rates = append(rates, r)
+		}
+	}
+	sort.Float64s(rates)
+	if descending {
+		sort.Sort(sort.Reverse(sort.Float64Slice(rates)))
+	}
+	out := make([]Order, len(rates))
+	for i, r := range rates {
+		out[i] = Order{Rate: toDecimal(r), Amount: toDecimal(levels[r])}
+	}
+	return out
+}
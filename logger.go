@@ -0,0 +1,67 @@
+package poloniex
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+type (
+	//Logger receives the log output of the client as a message and alternating keys and values,
+	//*slog.Logger implements it
+	Logger interface {
+		Debug(msg string, args ...interface{})
+		Info(msg string, args ...interface{})
+		Warn(msg string, args ...interface{})
+		Error(msg string, args ...interface{})
+	}
+
+	nopLogger struct{}
+
+	stdLogger struct {
+		l *log.Logger
+	}
+)
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// NewStdLogger returns a Logger writing every level to l as "LEVEL msg key=value ..."
+func NewStdLogger(l *log.Logger) Logger {
+	return stdLogger{l}
+}
+
+func (s stdLogger) Debug(msg string, args ...interface{}) { s.print("DEBUG", msg, args) }
+func (s stdLogger) Info(msg string, args ...interface{})  { s.print("INFO", msg, args) }
+func (s stdLogger) Warn(msg string, args ...interface{})  { s.print("WARN", msg, args) }
+func (s stdLogger) Error(msg string, args ...interface{}) { s.print("ERROR", msg, args) }
+
+func (s stdLogger) print(level, msg string, args []interface{}) {
+	b := &strings.Builder{}
+	b.WriteString(level + " " + msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(b, " %v", args[i])
+		}
+	}
+	s.l.Println(b.String())
+}
+
+// SetLogger sends the log output of the client to l, nothing is logged by default
+func (p *Poloniex) SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	p.logger = l
+}
+
+func (p *Poloniex) log() Logger {
+	if p.logger == nil {
+		return nopLogger{}
+	}
+	return p.logger
+}
@@ -0,0 +1,156 @@
+package poloniex
+
+import (
+	"context"
+	"math/big"
+	"net/url"
+	"strconv"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+)
+
+type (
+	//MarketSize is how much a market order trades, either an Amount of the second currency of the pair or
+	//a Total of the first, ETH or BTC of BTC_ETH
+	MarketSize struct {
+		Amount ggm.Decimal
+		Total  ggm.Decimal
+	}
+
+	//MarketOrder is a market order emulated by an immediate-or-cancel limit order. Rate is the limit it
+	//was placed at and Amount what it was placed for, Unfilled what of Amount the book didn't fill.
+	MarketOrder struct {
+		OrderNumber int64
+		Rate        ggm.Decimal
+		Amount      ggm.Decimal
+		Filled      ggm.Decimal
+		Total       ggm.Decimal
+		AvgPrice    ggm.Decimal
+		Unfilled    ggm.Decimal
+		Trades      []ResultingTrade
+	}
+
+	// iocOrder is what buy and sell return for an immediate-or-cancel order
+	iocOrder struct {
+		Buy
+		ResultingTrades []ResultingTrade
+		AmountUnfilled  *ggm.Decimal `json:",string"`
+	}
+)
+
+// MarketBuy buys size on pair at the asks of the order book up to maxSlippage, a fraction, above the lowest
+func (p *Poloniex) MarketBuy(pair string, size MarketSize, maxSlippage float64) (MarketOrder, error) {
+	return p.marketOrder(context.Background(), "buy", pair, size, maxSlippage)
+}
+
+// MarketBuyContext is MarketBuy with ctx like BuyContext, the order book is fetched as part of its span too
+func (p *Poloniex) MarketBuyContext(ctx context.Context, pair string, size MarketSize, maxSlippage float64) (MarketOrder, error) {
+	return p.marketOrder(ctx, "buy", pair, size, maxSlippage)
+}
+
+// MarketSell sells size on pair at the bids of the order book down to maxSlippage, a fraction, below the highest
+func (p *Poloniex) MarketSell(pair string, size MarketSize, maxSlippage float64) (MarketOrder, error) {
+	return p.marketOrder(context.Background(), "sell", pair, size, maxSlippage)
+}
+
+// MarketSellContext is MarketSell with ctx like MarketBuyContext
+func (p *Poloniex) MarketSellContext(ctx context.Context, pair string, size MarketSize, maxSlippage float64) (MarketOrder, error) {
+	return p.marketOrder(ctx, "sell", pair, size, maxSlippage)
+}
+
+// marketOrder walks the book for the rate filling size and places an immediate-or-cancel order there,
+// at the slippage limit when the book within it doesn't hold enough
+func (p *Poloniex) marketOrder(ctx context.Context, command, pair string, size MarketSize, maxSlippage float64) (m MarketOrder, err error) {
+	amount, total := toRat(size.Amount), toRat(size.Total)
+	if (amount.Sign() > 0) == (total.Sign() > 0) {
+		return m, errors.New("market order needs either an amount or a total")
+	}
+	slippage, ok := new(big.Rat).SetString(strconv.FormatFloat(maxSlippage, 'f', -1, 64))
+	if !ok || slippage.Sign() < 0 {
+		return m, errors.New("negative slippage")
+	}
+	ob, err := p.orderBook(ctx, pair)
+	if err != nil {
+		return m, errors.Wrap(err, "fetching order book failed")
+	}
+	if ob.IsFrozen {
+		return m, errors.New("market " + pair + " is frozen")
+	}
+	buy := command == "buy"
+	levels := ob.Bids
+	if buy {
+		levels = ob.Asks
+	}
+	if len(levels) == 0 {
+		return m, errors.New("no orders to take on " + pair)
+	}
+	one := big.NewRat(1, 1)
+	best := toRat(levels[0].Rate)
+	limit := truncRat(new(big.Rat).Mul(best, new(big.Rat).Sub(one, slippage)), 8, true)
+	if buy {
+		limit = truncRat(new(big.Rat).Mul(best, new(big.Rat).Add(one, slippage)), 8, false)
+	}
+	if limit.Sign() <= 0 {
+		return m, errors.New("slippage leaves no rate to sell at on " + pair)
+	}
+
+	rate, got, spent, covered := limit, new(big.Rat), new(big.Rat), false
+	for _, l := range levels {
+		r, a := toRat(l.Rate), toRat(l.Amount)
+		if (buy && r.Cmp(limit) > 0) || (!buy && r.Cmp(limit) < 0) {
+			break
+		}
+		cost := new(big.Rat).Mul(r, a)
+		if total.Sign() > 0 && new(big.Rat).Add(spent, cost).Cmp(total) >= 0 {
+			got.Add(got, new(big.Rat).Quo(new(big.Rat).Sub(total, spent), r))
+			rate, covered = r, true
+			break
+		}
+		if total.Sign() == 0 && new(big.Rat).Add(got, a).Cmp(amount) >= 0 {
+			rate, covered = r, true
+			break
+		}
+		got.Add(got, a)
+		spent.Add(spent, cost)
+	}
+	if total.Sign() == 0 {
+		got = amount
+	} else if most := new(big.Rat).Quo(total, limit); !covered && got.Cmp(most) > 0 {
+		// what the book holds within the limit, the order takes no more than total
+		got = most
+	}
+	if !covered {
+		rate = limit
+	}
+	got = truncRat(got, 8, false)
+	if got.Sign() <= 0 {
+		return m, errors.New("no orders to take on " + pair + " within the slippage")
+	}
+
+	m.Rate, m.Amount = ratDecimal(rate, 8), ratDecimal(got, 8)
+	o := iocOrder{}
+	if err = p.place(ctx, command, pair, m.Rate, m.Amount, url.Values{"immediateOrCancel": {"1"}}, &o, &o.Buy); err != nil {
+		return m, err
+	}
+	m.OrderNumber, m.Trades = o.OrderNumber, o.ResultingTrades
+	filled, value := new(big.Rat), new(big.Rat)
+	for _, t := range o.ResultingTrades {
+		filled.Add(filled, toRat(t.Amount))
+		value.Add(value, toRat(t.Total))
+	}
+	m.Filled, m.Total = ratDecimal(filled, 8), ratDecimal(value, 8)
+	if filled.Sign() > 0 {
+		m.AvgPrice = ratDecimal(new(big.Rat).Quo(value, filled), 8)
+	}
+	unfilled := new(big.Rat).Sub(got, filled)
+	if unfilled.Sign() < 0 {
+		unfilled.SetInt64(0)
+	}
+	m.Unfilled = ratDecimal(unfilled, 8)
+	if o.AmountUnfilled != nil {
+		m.Unfilled = *o.AmountUnfilled
+	}
+	p.log().Info("market order", "command", command, "pair", pair, "rate", m.Rate, "amount", m.Amount, "filled", m.Filled, "order", m.OrderNumber)
+	return m, nil
+}
@@ -0,0 +1,254 @@
+package poloniex
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	//Pair is a currency pair like BTC_ETH. As in the volumes of Ticker, Base is the currency
+	//prices are given in and Quote the one bought and sold.
+	Pair struct {
+		Base  string
+		Quote string
+	}
+
+	//Market is the state of a pair, Base and Quote are zero when Currencies doesn't list them
+	Market struct {
+		Pair   Pair
+		Ticker TickerEntry
+		Frozen bool
+		Base   Currency
+		Quote  Currency
+	}
+
+	//Markets is a registry of the pairs and currencies of the exchange built from Ticker and Currencies
+	Markets struct {
+		p          *Poloniex
+		mu         sync.RWMutex
+		markets    map[Pair]Market
+		currencies Currencies
+		fetched    time.Time
+		stop       chan struct{}
+		// refreshing is the refresh in progress for fresh, the callers meanwhile wait for it
+		refreshing *marketsRefresh
+	}
+
+	marketsRefresh struct {
+		done chan struct{}
+		err  error
+	}
+)
+
+// ParsePair splits a pair like BTC_ETH into its currencies
+func ParsePair(s string) (Pair, error) {
+	parts := strings.Split(s, "_")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Pair{}, errors.Errorf("invalid currency pair %q", s)
+	}
+	return Pair{Base: parts[0], Quote: parts[1]}, nil
+}
+
+// String returns the pair the way Poloniex writes it, e.g. BTC_ETH
+func (p Pair) String() string {
+	return p.Base + "_" + p.Quote
+}
+
+// Inactive returns why the market can't be traded, empty when it can
+func (m Market) Inactive() string {
+	if m.Frozen {
+		return "market is frozen"
+	}
+	for _, c := range []struct {
+		code string
+		cur  Currency
+	}{{m.Pair.Base, m.Base}, {m.Pair.Quote, m.Quote}} {
+		switch {
+		case c.cur.Delisted != 0:
+			return c.code + " is delisted"
+		case c.cur.Disabled != 0:
+			return c.code + " is disabled"
+		case c.cur.Frozen != 0:
+			return c.code + " is frozen"
+		}
+	}
+	return ""
+}
+
+// Active reports whether the market can be traded
+func (m Market) Active() bool {
+	return m.Inactive() == ""
+}
+
+// NewMarkets returns a registry filled by Ticker and Currencies of p, it is empty until refreshed
+func NewMarkets(p *Poloniex) *Markets {
+	return &Markets{p: p, markets: map[Pair]Market{}, currencies: Currencies{}}
+}
+
+// Refresh fetches the pairs and currencies
+func (m *Markets) Refresh() error {
+	ticker, err := m.p.Ticker()
+	if err != nil {
+		return errors.Wrap(err, "fetching markets failed")
+	}
+	currencies, err := m.p.Currencies()
+	if err != nil {
+		return errors.Wrap(err, "fetching currencies failed")
+	}
+	markets := map[Pair]Market{}
+	for s, t := range ticker {
+		pair, err := ParsePair(s)
+		if err != nil {
+			m.p.log().Warn("skipping market", "pair", s, "error", err)
+			continue
+		}
+		markets[pair] = Market{Pair: pair, Ticker: t, Frozen: t.IsFrozen != 0, Base: currencies[pair.Base], Quote: currencies[pair.Quote]}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.markets, m.currencies, m.fetched = markets, currencies, time.Now()
+	return nil
+}
+
+// RefreshEvery refreshes the registry in the background every interval until Stop, interval must be positive
+func (m *Markets) RefreshEvery(interval time.Duration) error {
+	if interval <= 0 {
+		return errors.Errorf("invalid refresh interval %v", interval)
+	}
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+			if err := m.Refresh(); err != nil {
+				m.p.log().Warn("refreshing markets failed", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends refreshing in the background
+func (m *Markets) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// Fetched is when the registry was last refreshed
+func (m *Markets) Fetched() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.fetched
+}
+
+// fresh refreshes the registry when it is older than maxAge, callers finding a refresh in progress wait for
+// it instead of starting their own
+func (m *Markets) fresh(maxAge time.Duration) error {
+	m.mu.Lock()
+	if time.Since(m.fetched) <= maxAge {
+		m.mu.Unlock()
+		return nil
+	}
+	if r := m.refreshing; r != nil {
+		m.mu.Unlock()
+		<-r.done
+		return r.err
+	}
+	r := &marketsRefresh{done: make(chan struct{})}
+	m.refreshing = r
+	m.mu.Unlock()
+	r.err = m.Refresh()
+	m.mu.Lock()
+	m.refreshing = nil
+	m.mu.Unlock()
+	close(r.done)
+	return r.err
+}
+
+// Market returns the state of pair
+func (m *Markets) Market(pair Pair) (Market, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	market, ok := m.markets[pair]
+	return market, ok
+}
+
+// Pairs returns the pairs that can be traded, sorted
+func (m *Markets) Pairs() []Pair {
+	return m.pairs(func(market Market) bool { return market.Active() })
+}
+
+// AllPairs returns every pair of the exchange, frozen ones and those of delisted currencies included, sorted
+func (m *Markets) AllPairs() []Pair {
+	return m.pairs(func(Market) bool { return true })
+}
+
+// Bases returns the currencies there are active markets in, e.g. BTC and USDT, sorted
+func (m *Markets) Bases() []string {
+	bases := map[string]bool{}
+	for _, p := range m.Pairs() {
+		bases[p.Base] = true
+	}
+	return sortedKeys(bases)
+}
+
+// Quotes returns the currencies traded against base on active markets, sorted
+func (m *Markets) Quotes(base string) []string {
+	quotes := map[string]bool{}
+	for _, p := range m.Pairs() {
+		if p.Base == base {
+			quotes[p.Quote] = true
+		}
+	}
+	return sortedKeys(quotes)
+}
+
+// Currency returns a currency by its code
+func (m *Markets) Currency(code string) (Currency, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.currencies[code]
+	return c, ok
+}
+
+func (m *Markets) pairs(keep func(Market) bool) []Pair {
+	m.mu.RLock()
+	pairs := []Pair{}
+	for p, market := range m.markets {
+		if keep(market) {
+			pairs = append(pairs, p)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].String() < pairs[j].String() })
+	return pairs
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,55 @@
+package poloniex
+
+import "time"
+
+type (
+	//Metrics receives measurements of the client's REST and websocket activity,
+	//poloniexprom and poloniexotel adapt it to Prometheus and OpenTelemetry
+	Metrics interface {
+		// ObserveRequest is called after every REST call, api is "public" or "private". errorKind is empty
+		// on success, an ErrorKind for errors Poloniex answered with and "transport" for anything else.
+		ObserveRequest(api, command string, latency time.Duration, errorKind string)
+		// ObserveRateLimitWait is called with the time a call waited for the rate limiter
+		ObserveRateLimitWait(wait time.Duration)
+		// ObserveReconnect is called when MonitorHeartbeat reestablished a websocket connection, feed is
+		// "push" for the push API and "wamp" for the WAMP one
+		ObserveReconnect(feed string)
+		// ObserveMessage is called for every websocket message handed to the subscribers of topic,
+		// lag is the age of the message when it arrived if it carries a timestamp and negative otherwise
+		ObserveMessage(topic string, lag time.Duration)
+	}
+
+	nopMetrics struct{}
+)
+
+func (nopMetrics) ObserveRequest(string, string, time.Duration, string) {}
+func (nopMetrics) ObserveRateLimitWait(time.Duration)                   {}
+func (nopMetrics) ObserveReconnect(string)                              {}
+func (nopMetrics) ObserveMessage(string, time.Duration)                 {}
+
+// SetMetrics sends measurements of the client to m, nothing is measured by default
+func (p *Poloniex) SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	p.metrics = m
+}
+
+func (p *Poloniex) measure() Metrics {
+	if p.metrics == nil {
+		return nopMetrics{}
+	}
+	return p.metrics
+}
+
+// messageLag is how old v was when it arrived, negative if it has no timestamp
+func messageLag(v interface{}) time.Duration {
+	if o, ok := v.(WSOrderOrTrade); ok {
+		for _, order := range o.Orders {
+			if order.Type == "newTrade" && !order.Data.TS.IsZero() {
+				return time.Since(order.Data.TS)
+			}
+		}
+	}
+	return -1
+}
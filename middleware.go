@@ -0,0 +1,43 @@
+package poloniex
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+type (
+	//Request is a REST call on its way through the middleware chain, Kind is "public" or "private".
+	//Private calls are signed at the end of the chain, so middleware may change their Params.
+	//Context carries the span of the call when it is traced.
+	Request struct {
+		Context context.Context
+		Kind    string
+		Command string
+		Params  url.Values
+		Headers map[string]string
+	}
+
+	//Response is the raw answer to a REST call, Latency is the time spent on the network
+	Response struct {
+		Status  int
+		Body    string
+		Latency time.Duration
+	}
+
+	//Handler performs a REST call
+	Handler func(r *Request) (*Response, error)
+
+	//Middleware wraps the handler of the rest of the chain, it may change the request or the response,
+	//answer itself (caching, fault injection) or just watch (metrics, auditing). Calls of the client are
+	//serialized while a middleware runs, so it must not call the client itself.
+	Middleware func(next Handler) Handler
+)
+
+// Use appends middleware to the chain every public and private REST call goes through,
+// the first one added sees a call first
+func (p *Poloniex) Use(m ...Middleware) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.middleware = append(p.middleware, m...)
+}
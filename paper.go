@@ -0,0 +1,151 @@
+package poloniex
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api/internal/sim"
+)
+
+type (
+	//PaperTrading is a simulated account the client trades on instead of the real one, orders are matched
+	//against the live order book when placed and against live trades from the websocket while resting
+	PaperTrading struct {
+		p        *Poloniex
+		exchange *sim.Exchange
+		mu       sync.Mutex
+		feeds    map[string]*OrderSubscription
+	}
+
+	// paperKey marks the context of a call the simulated account answers
+	paperKey struct{}
+)
+
+// PaperTrade switches the trading commands of the client (Buy, Sell, Move, CancelOrder, OpenOrders, Balances,
+// PrivateTradeHistory, OrderTrades, FeeInfo) to a simulated account holding balances, public and websocket
+// calls keep going to Poloniex. The account's maker and taker fees are taken from FeeInfo when there are credentials.
+// The simulated calls go through the middleware chain, metrics and tracing like real ones, with the simulated
+// account answering at the end of the chain instead of Poloniex.
+func (p *Poloniex) PaperTrade(balances map[string]ggm.Decimal) (*PaperTrading, error) {
+	e := sim.New()
+	if key, _ := p.keys(); key != "" {
+		fi, err := p.FeeInfo()
+		if err != nil {
+			return nil, err
+		}
+		e.MakerFee = toFloat(fi.MakerFee)
+		e.TakerFee = toFloat(fi.TakerFee)
+	}
+	for c, b := range balances {
+		e.SetBalance(c, toFloat(b))
+	}
+	pt := &PaperTrading{p: p, exchange: e, feeds: map[string]*OrderSubscription{}}
+	p.paperMutex.Lock()
+	p.paper = pt
+	p.paperMutex.Unlock()
+	return pt, nil
+}
+
+// Stop switches the client back to the real account, the simulated one is left as it is
+func (pt *PaperTrading) Stop() {
+	pt.p.paperMutex.Lock()
+	if pt.p.paper == pt {
+		pt.p.paper = nil
+	}
+	pt.p.paperMutex.Unlock()
+	pt.mu.Lock()
+	feeds := pt.feeds
+	pt.feeds = map[string]*OrderSubscription{}
+	pt.mu.Unlock()
+	for _, s := range feeds {
+		s.Close()
+	}
+}
+
+// paperTrading is the simulated account the client trades on, nil when trading for real
+func (p *Poloniex) paperTrading() *PaperTrading {
+	p.paperMutex.Lock()
+	defer p.paperMutex.Unlock()
+	return p.paper
+}
+
+func (pt *PaperTrading) serves(command string) bool {
+	return sim.Commands[command]
+}
+
+// serve answers a trading command from the simulated account, as the exchange would in JSON
+func (pt *PaperTrading) serve(command string, params url.Values) (string, error) {
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("command", command)
+
+	pair := form.Get("currencyPair")
+	if command == "moveOrder" {
+		n, _ := strconv.ParseInt(form.Get("orderNumber"), 10, 64)
+		if o, ok := pt.exchange.Order(n); ok {
+			pair = o.Pair
+		}
+	}
+	if (command == "buy" || command == "sell" || command == "moveOrder") && pair != "" {
+		if err := pt.refresh(pair); err != nil {
+			return "", err
+		}
+		pt.watch(pair)
+	}
+
+	b, err := json.Marshal(pt.exchange.Command(form))
+	return string(b), err
+}
+
+// refresh replaces the simulated liquidity of pair with the live order book
+func (pt *PaperTrading) refresh(pair string) error {
+	ob, err := pt.p.OrderBook(pair)
+	if err != nil {
+		return err
+	}
+	pt.exchange.SetBook(pair, toLevels(ob.Asks), toLevels(ob.Bids))
+	return nil
+}
+
+// watch fills resting simulated orders of pair from the live trades of the websocket feed
+func (pt *PaperTrading) watch(pair string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if _, ok := pt.feeds[pair]; ok {
+		return
+	}
+	sub, err := pt.p.NewOrderSubscription(pair)
+	if err != nil {
+		pt.p.log().Warn("paper trading without live trades", "pair", pair, "error", err)
+		return
+	}
+	pt.feeds[pair] = sub
+	go func() {
+		for o := range sub.C {
+			for _, v := range o.Orders {
+				if v.Type != "newTrade" {
+					continue
+				}
+				// a buyer takes the asks, so resting sells are filled, and the other way round
+				side := sim.Buy
+				if v.Data.Type == "buy" {
+					side = sim.Sell
+				}
+				pt.exchange.Trade(pair, side, toFloat(v.Data.Rate), toFloat(v.Data.Amount))
+			}
+		}
+	}()
+}
+
+func toLevels(orders []Order) []sim.Level {
+	l := make([]sim.Level, len(orders))
+	for i := range orders {
+		l[i] = sim.Level{Rate: toFloat(orders[i].Rate), Amount: toFloat(orders[i].Amount)}
+	}
+	return l
+}
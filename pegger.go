@@ -0,0 +1,258 @@
+package poloniex
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+)
+
+type (
+	//PegConfig is how a Pegger prices its order. Offset improves on the best price of the own side, a
+	//buy is placed at the best bid + Offset and a sell at the best ask - Offset, a negative Offset stays
+	//behind it. Limit is the highest rate a buy and the lowest rate a sell may be moved to, none if zero.
+	PegConfig struct {
+		Offset   float64
+		Limit    float64
+		PostOnly bool
+		// MinInterval is the least time between two moves of the order, half a second by default
+		MinInterval time.Duration
+		// CheckInterval is how often the order is looked up in OpenOrders to notice it was filled or
+		// cancelled, 10 seconds by default
+		CheckInterval time.Duration
+	}
+
+	//Pegger keeps a limit order at the best bid or ask of the live order book, moving it whenever the
+	//book changes. Moves give the order a new number, OrderNumber is always the current one.
+	Pegger struct {
+		p      *Poloniex
+		book   *LiveOrderBook
+		config PegConfig
+		pair   string
+		side   string
+		amount float64
+
+		mu       sync.Mutex
+		number   int64
+		rate     float64
+		err      error
+		stop     chan struct{}
+		stopOnce sync.Once
+		done     chan struct{}
+	}
+)
+
+// Peg places a limit order of side "buy" or "sell" for amount on pair at the price of c and keeps it
+// pegged until it is filled or cancelled, or Stop
+func (p *Poloniex) Peg(pair, side string, amount ggm.Decimal, c PegConfig) (*Pegger, error) {
+	if side != "buy" && side != "sell" {
+		return nil, errors.Errorf("invalid side %q", side)
+	}
+	if c.MinInterval <= 0 {
+		c.MinInterval = 500 * time.Millisecond
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = 10 * time.Second
+	}
+	book, err := p.NewLiveOrderBook(pair)
+	if err != nil {
+		return nil, err
+	}
+	g := &Pegger{p: p, book: book, config: c, pair: pair, side: side, amount: toFloat(amount),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	rate, ok := g.target()
+	if !ok {
+		book.Close()
+		return nil, errors.New("no price to peg " + pair + " to")
+	}
+	var o Buy
+	switch {
+	case side == "buy" && c.PostOnly:
+		o, err = p.BuyPostOnly(pair, toDecimal(rate), amount)
+	case side == "buy":
+		o, err = p.Buy(pair, toDecimal(rate), amount)
+	case c.PostOnly:
+		var s Sell
+		s, err = p.SellPostOnly(pair, toDecimal(rate), amount)
+		o = s.Buy
+	default:
+		var s Sell
+		s, err = p.Sell(pair, toDecimal(rate), amount)
+		o = s.Buy
+	}
+	if err != nil {
+		book.Close()
+		return nil, err
+	}
+	g.number, g.rate = o.OrderNumber, rate
+	go g.run()
+	return g, nil
+}
+
+// OrderNumber is the number of the pegged order, it changes with every move
+func (g *Pegger) OrderNumber() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.number
+}
+
+// Rate is the rate of the pegged order
+func (g *Pegger) Rate() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rate
+}
+
+// Done is closed when the pegging ended, because the order left the book, a move failed, the order book
+// feed ended or Stop
+func (g *Pegger) Done() <-chan struct{} {
+	return g.done
+}
+
+// Err is why the pegging ended, nil while it runs, after Stop and when the order left the book
+func (g *Pegger) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Stop ends the pegging, the order stays in the book at its last rate
+func (g *Pegger) Stop() {
+	g.stopOnce.Do(func() { close(g.stop) })
+	<-g.done
+}
+
+// Cancel ends the pegging and cancels the order
+func (g *Pegger) Cancel() (bool, error) {
+	g.Stop()
+	return g.p.CancelOrder(g.OrderNumber())
+}
+
+func (g *Pegger) run() {
+	defer close(g.done)
+	defer g.book.Close()
+	check := time.NewTicker(g.config.CheckInterval)
+	defer check.Stop()
+	var last time.Time
+	for {
+		var wait <-chan time.Time
+		if d := g.config.MinInterval - time.Since(last); d > 0 {
+			// throttled, look at the book again once the interval passed
+			wait = time.After(d)
+		}
+		select {
+		case <-g.stop:
+			return
+		case <-g.book.Done():
+			g.mu.Lock()
+			g.err = g.book.Err()
+			g.mu.Unlock()
+			return
+		case <-check.C:
+			if !g.inBook() {
+				// filled or cancelled
+				return
+			}
+			continue
+		case <-g.book.Updated():
+		case <-wait:
+		}
+		if time.Since(last) < g.config.MinInterval {
+			continue
+		}
+		rate, ok := g.target()
+		if !ok || rate == g.Rate() {
+			continue
+		}
+		last = time.Now()
+		if err := g.move(rate); err != nil {
+			if errors.Is(err, &APIError{Kind: ErrorUnknownOrder}) {
+				// filled or cancelled
+				return
+			}
+			g.mu.Lock()
+			g.err = err
+			g.mu.Unlock()
+			return
+		}
+	}
+}
+
+// inBook reports whether the order is still open, also when it can't be looked up
+func (g *Pegger) inBook() bool {
+	n := g.OrderNumber()
+	open, err := g.p.OpenOrders(g.pair)
+	if err != nil {
+		g.p.log().Warn("looking up pegged order failed", "pair", g.pair, "order", n, "error", err)
+		return true
+	}
+	for _, o := range open {
+		if o.OrderNumber == n {
+			return true
+		}
+	}
+	g.p.log().Info("pegged order left the book", "pair", g.pair, "order", n)
+	return false
+}
+
+func (g *Pegger) move(rate float64) error {
+	n := g.OrderNumber()
+	var m MoveOrder
+	var err error
+	if g.config.PostOnly {
+		m, err = g.p.MovePostOnly(n, toDecimal(rate))
+	} else {
+		m, err = g.p.Move(n, toDecimal(rate))
+	}
+	if errors.Is(err, &APIError{Kind: ErrorRejected}) {
+		// the book moved into the rate meanwhile, the next update prices it again
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if m.Success != 1 {
+		return &APIError{Command: "moveOrder", Message: m.Error, Kind: errorKind(m.Error, 200)}
+	}
+	g.p.log().Debug("pegged order moved", "pair", g.pair, "from", n, "to", m.OrderNumber, "rate", rate)
+	g.mu.Lock()
+	g.number, g.rate = m.OrderNumber, rate
+	g.mu.Unlock()
+	return nil
+}
+
+// target is the rate the order should be at, the order itself doesn't count towards the best price
+func (g *Pegger) target() (float64, bool) {
+	ob := g.book.OrderBook()
+	levels := ob.Bids
+	if g.side == "sell" {
+		levels = ob.Asks
+	}
+	own := g.Rate()
+	best := 0.0
+	for _, l := range levels {
+		rate, amount := toFloat(l.Rate), toFloat(l.Amount)
+		if own != 0 && rate == own && amount <= g.amount+1e-9 {
+			continue
+		}
+		best = rate
+		break
+	}
+	if best == 0 {
+		return 0, false
+	}
+	rate := best + g.config.Offset
+	if g.side == "sell" {
+		rate = best - g.config.Offset
+	}
+	if l := g.config.Limit; l > 0 {
+		if g.side == "buy" {
+			rate = math.Min(rate, l)
+		} else {
+			rate = math.Max(rate, l)
+		}
+	}
+	return math.Round(rate*1e8) / 1e8, rate > 0
+}
@@ -0,0 +1,847 @@
+// Code generated by internal/mockgen from client.go. DO NOT EDIT.
+
+// Package poloniexmock is a mock of poloniex.Client for tests that shouldn't touch the network
+package poloniexmock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api"
+)
+
+// Client is a poloniex.Client whose methods call the function field of the same name with a Func suffix,
+// a method whose field is nil returns zero values. Every call is recorded.
+type Client struct {
+	mu                             sync.Mutex
+	calls                          []Call
+	TickerFunc                     func() (poloniex.Ticker, error)
+	DailyVolumeFunc                func() (poloniex.DailyVolume, error)
+	OrderBookFunc                  func(pair string) (poloniex.OrderBook, error)
+	OrderBookAllFunc               func() (poloniex.OrderBookAll, error)
+	TradeHistoryFunc               func(in ...interface{}) (poloniex.TradeHistory, error)
+	ChartDataFunc                  func(pair string) (poloniex.ChartData, error)
+	ChartDataPeriodFunc            func(pair string, start time.Time, end time.Time) (poloniex.ChartData, error)
+	ChartDataCurrentFunc           func(pair string) (poloniex.ChartData, error)
+	CurrenciesFunc                 func() (poloniex.Currencies, error)
+	LoanOrdersFunc                 func(currency string) (poloniex.LoanOrders, error)
+	BalancesFunc                   func() (poloniex.Balances, error)
+	AccountBalancesFunc            func() (poloniex.AccountBalances, error)
+	AvailableAccountBalancesFunc   func() (poloniex.AvailableAccountBalances, error)
+	TradableBalancesFunc           func() (poloniex.TradableBalances, error)
+	TransferBalanceFunc            func(currency string, amount ggm.Decimal, from string, to string) (poloniex.TransferBalance, error)
+	MarginAccountSummaryFunc       func() (poloniex.MarginAccountSummary, error)
+	FeeInfoFunc                    func() (poloniex.FeeInfo, error)
+	AddressesFunc                  func() (poloniex.Addresses, error)
+	GenerateNewAddressFunc         func(currency string) (string, error)
+	DepositsWithdrawalsFunc        func() (poloniex.DepositsWithdrawals, error)
+	DepositsWithdrawalsRangeFunc   func(start time.Time, end time.Time) (poloniex.DepositsWithdrawals, error)
+	WithdrawFunc                   func(currency string, amount ggm.Decimal, address string) (poloniex.Withdraw, error)
+	WithdrawPaymentIDFunc          func(currency string, amount ggm.Decimal, address string, paymentID string) (poloniex.Withdraw, error)
+	OpenOrdersFunc                 func(pair string) (poloniex.OpenOrders, error)
+	OpenOrdersAllFunc              func() (poloniex.OpenOrdersAll, error)
+	PrivateTradeHistoryFunc        func(pair string) (poloniex.PrivateTradeHistory, error)
+	PrivateTradeHistoryAllFunc     func() (poloniex.PrivateTradeHistoryAll, error)
+	OrderTradesFunc                func(orderNumber int64) (poloniex.OrderTrades, error)
+	BuyFunc                        func(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error)
+	BuyPostOnlyFunc                func(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error)
+	SellFunc                       func(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error)
+	SellPostOnlyFunc               func(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error)
+	MoveFunc                       func(orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error)
+	MovePostOnlyFunc               func(orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error)
+	MarketBuyFunc                  func(pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error)
+	MarketSellFunc                 func(pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error)
+	CancelOrderFunc                func(orderNumber int64) (bool, error)
+	BuyContextFunc                 func(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error)
+	SellContextFunc                func(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error)
+	MoveContextFunc                func(ctx context.Context, orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error)
+	CancelOrderContextFunc         func(ctx context.Context, orderNumber int64) (bool, error)
+	BuyPostOnlyContextFunc         func(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error)
+	SellPostOnlyContextFunc        func(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error)
+	MovePostOnlyContextFunc        func(ctx context.Context, orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error)
+	MarketBuyContextFunc           func(ctx context.Context, pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error)
+	MarketSellContextFunc          func(ctx context.Context, pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error)
+	WithdrawContextFunc            func(ctx context.Context, currency string, amount ggm.Decimal, address string) (poloniex.Withdraw, error)
+	WithdrawPaymentIDContextFunc   func(ctx context.Context, currency string, amount ggm.Decimal, address string, paymentID string) (poloniex.Withdraw, error)
+	OpenOrdersContextFunc          func(ctx context.Context, pair string) (poloniex.OpenOrders, error)
+	OrderTradesContextFunc         func(ctx context.Context, orderNumber int64) (poloniex.OrderTrades, error)
+	LoanOfferFunc                  func(currency string, amount ggm.Decimal, duration int, renew bool, lendingRate ggm.Decimal) (poloniex.LoanOffer, error)
+	CancelLoanOfferFunc            func(orderNumber int64) (bool, error)
+	OpenLoanOffersFunc             func() (poloniex.OpenLoanOffers, error)
+	ActiveLoansFunc                func() (poloniex.ActiveLoans, error)
+	ToggleAutoRenewFunc            func(orderNumber int64) (bool, error)
+	NewTickerSubscriptionFunc      func() (*poloniex.TickerSubscription, error)
+	NewOrderSubscriptionFunc       func(code string) (*poloniex.OrderSubscription, error)
+	NewAccountSubscriptionFunc     func() (*poloniex.AccountSubscription, error)
+	NewDailyVolumeSubscriptionFunc func() (*poloniex.DailyVolumeSubscription, error)
+	SubscribeTickerFunc            func() poloniex.WSTickerChan
+	SubscribeOrderFunc             func(code string) poloniex.WSOrderOrTradeChan
+	UnsubscribeTickerFunc          func()
+	UnsubscribeOrderFunc           func(code string)
+	UnsubscribeFunc                func(code string)
+	MonitorHeartbeatFunc           func(timeout time.Duration)
+	LastMessageAgeFunc             func() (time.Duration, bool)
+	CloseFunc                      func() error
+	ShutdownFunc                   func(ctx context.Context) error
+}
+
+// Call is a recorded method call
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+var _ poloniex.Client = (*Client)(nil)
+
+// Calls returns the calls made so far, of every method if method is empty
+func (m *Client) Calls(method string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	calls := []Call{}
+	for _, c := range m.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func (m *Client) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+}
+
+// Ticker calls TickerFunc
+func (m *Client) Ticker() (poloniex.Ticker, error) {
+	m.record("Ticker")
+	if m.TickerFunc != nil {
+		return m.TickerFunc()
+	}
+	var r0 poloniex.Ticker
+	var r1 error
+	return r0, r1
+}
+
+// DailyVolume calls DailyVolumeFunc
+func (m *Client) DailyVolume() (poloniex.DailyVolume, error) {
+	m.record("DailyVolume")
+	if m.DailyVolumeFunc != nil {
+		return m.DailyVolumeFunc()
+	}
+	var r0 poloniex.DailyVolume
+	var r1 error
+	return r0, r1
+}
+
+// OrderBook calls OrderBookFunc
+func (m *Client) OrderBook(pair string) (poloniex.OrderBook, error) {
+	m.record("OrderBook", pair)
+	if m.OrderBookFunc != nil {
+		return m.OrderBookFunc(pair)
+	}
+	var r0 poloniex.OrderBook
+	var r1 error
+	return r0, r1
+}
+
+// OrderBookAll calls OrderBookAllFunc
+func (m *Client) OrderBookAll() (poloniex.OrderBookAll, error) {
+	m.record("OrderBookAll")
+	if m.OrderBookAllFunc != nil {
+		return m.OrderBookAllFunc()
+	}
+	var r0 poloniex.OrderBookAll
+	var r1 error
+	return r0, r1
+}
+
+// TradeHistory calls TradeHistoryFunc
+func (m *Client) TradeHistory(in ...interface{}) (poloniex.TradeHistory, error) {
+	m.record("TradeHistory", in)
+	if m.TradeHistoryFunc != nil {
+		return m.TradeHistoryFunc(in...)
+	}
+	var r0 poloniex.TradeHistory
+	var r1 error
+	return r0, r1
+}
+
+// ChartData calls ChartDataFunc
+func (m *Client) ChartData(pair string) (poloniex.ChartData, error) {
+	m.record("ChartData", pair)
+	if m.ChartDataFunc != nil {
+		return m.ChartDataFunc(pair)
+	}
+	var r0 poloniex.ChartData
+	var r1 error
+	return r0, r1
+}
+
+// ChartDataPeriod calls ChartDataPeriodFunc
+func (m *Client) ChartDataPeriod(pair string, start time.Time, end time.Time) (poloniex.ChartData, error) {
+	m.record("ChartDataPeriod", pair, start, end)
+	if m.ChartDataPeriodFunc != nil {
+		return m.ChartDataPeriodFunc(pair, start, end)
+	}
+	var r0 poloniex.ChartData
+	var r1 error
+	return r0, r1
+}
+
+// ChartDataCurrent calls ChartDataCurrentFunc
+func (m *Client) ChartDataCurrent(pair string) (poloniex.ChartData, error) {
+	m.record("ChartDataCurrent", pair)
+	if m.ChartDataCurrentFunc != nil {
+		return m.ChartDataCurrentFunc(pair)
+	}
+	var r0 poloniex.ChartData
+	var r1 error
+	return r0, r1
+}
+
+// Currencies calls CurrenciesFunc
+func (m *Client) Currencies() (poloniex.Currencies, error) {
+	m.record("Currencies")
+	if m.CurrenciesFunc != nil {
+		return m.CurrenciesFunc()
+	}
+	var r0 poloniex.Currencies
+	var r1 error
+	return r0, r1
+}
+
+// LoanOrders calls LoanOrdersFunc
+func (m *Client) LoanOrders(currency string) (poloniex.LoanOrders, error) {
+	m.record("LoanOrders", currency)
+	if m.LoanOrdersFunc != nil {
+		return m.LoanOrdersFunc(currency)
+	}
+	var r0 poloniex.LoanOrders
+	var r1 error
+	return r0, r1
+}
+
+// Balances calls BalancesFunc
+func (m *Client) Balances() (poloniex.Balances, error) {
+	m.record("Balances")
+	if m.BalancesFunc != nil {
+		return m.BalancesFunc()
+	}
+	var r0 poloniex.Balances
+	var r1 error
+	return r0, r1
+}
+
+// AccountBalances calls AccountBalancesFunc
+func (m *Client) AccountBalances() (poloniex.AccountBalances, error) {
+	m.record("AccountBalances")
+	if m.AccountBalancesFunc != nil {
+		return m.AccountBalancesFunc()
+	}
+	var r0 poloniex.AccountBalances
+	var r1 error
+	return r0, r1
+}
+
+// AvailableAccountBalances calls AvailableAccountBalancesFunc
+func (m *Client) AvailableAccountBalances() (poloniex.AvailableAccountBalances, error) {
+	m.record("AvailableAccountBalances")
+	if m.AvailableAccountBalancesFunc != nil {
+		return m.AvailableAccountBalancesFunc()
+	}
+	var r0 poloniex.AvailableAccountBalances
+	var r1 error
+	return r0, r1
+}
+
+// TradableBalances calls TradableBalancesFunc
+func (m *Client) TradableBalances() (poloniex.TradableBalances, error) {
+	m.record("TradableBalances")
+	if m.TradableBalancesFunc != nil {
+		return m.TradableBalancesFunc()
+	}
+	var r0 poloniex.TradableBalances
+	var r1 error
+	return r0, r1
+}
+
+// TransferBalance calls TransferBalanceFunc
+func (m *Client) TransferBalance(currency string, amount ggm.Decimal, from string, to string) (poloniex.TransferBalance, error) {
+	m.record("TransferBalance", currency, amount, from, to)
+	if m.TransferBalanceFunc != nil {
+		return m.TransferBalanceFunc(currency, amount, from, to)
+	}
+	var r0 poloniex.TransferBalance
+	var r1 error
+	return r0, r1
+}
+
+// MarginAccountSummary calls MarginAccountSummaryFunc
+func (m *Client) MarginAccountSummary() (poloniex.MarginAccountSummary, error) {
+	m.record("MarginAccountSummary")
+	if m.MarginAccountSummaryFunc != nil {
+		return m.MarginAccountSummaryFunc()
+	}
+	var r0 poloniex.MarginAccountSummary
+	var r1 error
+	return r0, r1
+}
+
+// FeeInfo calls FeeInfoFunc
+func (m *Client) FeeInfo() (poloniex.FeeInfo, error) {
+	m.record("FeeInfo")
+	if m.FeeInfoFunc != nil {
+		return m.FeeInfoFunc()
+	}
+	var r0 poloniex.FeeInfo
+	var r1 error
+	return r0, r1
+}
+
+// Addresses calls AddressesFunc
+func (m *Client) Addresses() (poloniex.Addresses, error) {
+	m.record("Addresses")
+	if m.AddressesFunc != nil {
+		return m.AddressesFunc()
+	}
+	var r0 poloniex.Addresses
+	var r1 error
+	return r0, r1
+}
+
+// GenerateNewAddress calls GenerateNewAddressFunc
+func (m *Client) GenerateNewAddress(currency string) (string, error) {
+	m.record("GenerateNewAddress", currency)
+	if m.GenerateNewAddressFunc != nil {
+		return m.GenerateNewAddressFunc(currency)
+	}
+	var r0 string
+	var r1 error
+	return r0, r1
+}
+
+// DepositsWithdrawals calls DepositsWithdrawalsFunc
+func (m *Client) DepositsWithdrawals() (poloniex.DepositsWithdrawals, error) {
+	m.record("DepositsWithdrawals")
+	if m.DepositsWithdrawalsFunc != nil {
+		return m.DepositsWithdrawalsFunc()
+	}
+	var r0 poloniex.DepositsWithdrawals
+	var r1 error
+	return r0, r1
+}
+
+// DepositsWithdrawalsRange calls DepositsWithdrawalsRangeFunc
+func (m *Client) DepositsWithdrawalsRange(start time.Time, end time.Time) (poloniex.DepositsWithdrawals, error) {
+	m.record("DepositsWithdrawalsRange", start, end)
+	if m.DepositsWithdrawalsRangeFunc != nil {
+		return m.DepositsWithdrawalsRangeFunc(start, end)
+	}
+	var r0 poloniex.DepositsWithdrawals
+	var r1 error
+	return r0, r1
+}
+
+// Withdraw calls WithdrawFunc
+func (m *Client) Withdraw(currency string, amount ggm.Decimal, address string) (poloniex.Withdraw, error) {
+	m.record("Withdraw", currency, amount, address)
+	if m.WithdrawFunc != nil {
+		return m.WithdrawFunc(currency, amount, address)
+	}
+	var r0 poloniex.Withdraw
+	var r1 error
+	return r0, r1
+}
+
+// WithdrawPaymentID calls WithdrawPaymentIDFunc
+func (m *Client) WithdrawPaymentID(currency string, amount ggm.Decimal, address string, paymentID string) (poloniex.Withdraw, error) {
+	m.record("WithdrawPaymentID", currency, amount, address, paymentID)
+	if m.WithdrawPaymentIDFunc != nil {
+		return m.WithdrawPaymentIDFunc(currency, amount, address, paymentID)
+	}
+	var r0 poloniex.Withdraw
+	var r1 error
+	return r0, r1
+}
+
+// OpenOrders calls OpenOrdersFunc
+func (m *Client) OpenOrders(pair string) (poloniex.OpenOrders, error) {
+	m.record("OpenOrders", pair)
+	if m.OpenOrdersFunc != nil {
+		return m.OpenOrdersFunc(pair)
+	}
+	var r0 poloniex.OpenOrders
+	var r1 error
+	return r0, r1
+}
+
+// OpenOrdersAll calls OpenOrdersAllFunc
+func (m *Client) OpenOrdersAll() (poloniex.OpenOrdersAll, error) {
+	m.record("OpenOrdersAll")
+	if m.OpenOrdersAllFunc != nil {
+		return m.OpenOrdersAllFunc()
+	}
+	var r0 poloniex.OpenOrdersAll
+	var r1 error
+	return r0, r1
+}
+
+// PrivateTradeHistory calls PrivateTradeHistoryFunc
+func (m *Client) PrivateTradeHistory(pair string) (poloniex.PrivateTradeHistory, error) {
+	m.record("PrivateTradeHistory", pair)
+	if m.PrivateTradeHistoryFunc != nil {
+		return m.PrivateTradeHistoryFunc(pair)
+	}
+	var r0 poloniex.PrivateTradeHistory
+	var r1 error
+	return r0, r1
+}
+
+// PrivateTradeHistoryAll calls PrivateTradeHistoryAllFunc
+func (m *Client) PrivateTradeHistoryAll() (poloniex.PrivateTradeHistoryAll, error) {
+	m.record("PrivateTradeHistoryAll")
+	if m.PrivateTradeHistoryAllFunc != nil {
+		return m.PrivateTradeHistoryAllFunc()
+	}
+	var r0 poloniex.PrivateTradeHistoryAll
+	var r1 error
+	return r0, r1
+}
+
+// OrderTrades calls OrderTradesFunc
+func (m *Client) OrderTrades(orderNumber int64) (poloniex.OrderTrades, error) {
+	m.record("OrderTrades", orderNumber)
+	if m.OrderTradesFunc != nil {
+		return m.OrderTradesFunc(orderNumber)
+	}
+	var r0 poloniex.OrderTrades
+	var r1 error
+	return r0, r1
+}
+
+// Buy calls BuyFunc
+func (m *Client) Buy(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error) {
+	m.record("Buy", pair, rate, amount)
+	if m.BuyFunc != nil {
+		return m.BuyFunc(pair, rate, amount)
+	}
+	var r0 poloniex.Buy
+	var r1 error
+	return r0, r1
+}
+
+// BuyPostOnly calls BuyPostOnlyFunc
+func (m *Client) BuyPostOnly(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error) {
+	m.record("BuyPostOnly", pair, rate, amount)
+	if m.BuyPostOnlyFunc != nil {
+		return m.BuyPostOnlyFunc(pair, rate, amount)
+	}
+	var r0 poloniex.Buy
+	var r1 error
+	return r0, r1
+}
+
+// Sell calls SellFunc
+func (m *Client) Sell(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error) {
+	m.record("Sell", pair, rate, amount)
+	if m.SellFunc != nil {
+		return m.SellFunc(pair, rate, amount)
+	}
+	var r0 poloniex.Sell
+	var r1 error
+	return r0, r1
+}
+
+// SellPostOnly calls SellPostOnlyFunc
+func (m *Client) SellPostOnly(pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error) {
+	m.record("SellPostOnly", pair, rate, amount)
+	if m.SellPostOnlyFunc != nil {
+		return m.SellPostOnlyFunc(pair, rate, amount)
+	}
+	var r0 poloniex.Sell
+	var r1 error
+	return r0, r1
+}
+
+// Move calls MoveFunc
+func (m *Client) Move(orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error) {
+	m.record("Move", orderNumber, rate)
+	if m.MoveFunc != nil {
+		return m.MoveFunc(orderNumber, rate)
+	}
+	var r0 poloniex.MoveOrder
+	var r1 error
+	return r0, r1
+}
+
+// MovePostOnly calls MovePostOnlyFunc
+func (m *Client) MovePostOnly(orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error) {
+	m.record("MovePostOnly", orderNumber, rate)
+	if m.MovePostOnlyFunc != nil {
+		return m.MovePostOnlyFunc(orderNumber, rate)
+	}
+	var r0 poloniex.MoveOrder
+	var r1 error
+	return r0, r1
+}
+
+// MarketBuy calls MarketBuyFunc
+func (m *Client) MarketBuy(pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error) {
+	m.record("MarketBuy", pair, size, maxSlippage)
+	if m.MarketBuyFunc != nil {
+		return m.MarketBuyFunc(pair, size, maxSlippage)
+	}
+	var r0 poloniex.MarketOrder
+	var r1 error
+	return r0, r1
+}
+
+// MarketSell calls MarketSellFunc
+func (m *Client) MarketSell(pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error) {
+	m.record("MarketSell", pair, size, maxSlippage)
+	if m.MarketSellFunc != nil {
+		return m.MarketSellFunc(pair, size, maxSlippage)
+	}
+	var r0 poloniex.MarketOrder
+	var r1 error
+	return r0, r1
+}
+
+// CancelOrder calls CancelOrderFunc
+func (m *Client) CancelOrder(orderNumber int64) (bool, error) {
+	m.record("CancelOrder", orderNumber)
+	if m.CancelOrderFunc != nil {
+		return m.CancelOrderFunc(orderNumber)
+	}
+	var r0 bool
+	var r1 error
+	return r0, r1
+}
+
+// BuyContext calls BuyContextFunc
+func (m *Client) BuyContext(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error) {
+	m.record("BuyContext", ctx, pair, rate, amount)
+	if m.BuyContextFunc != nil {
+		return m.BuyContextFunc(ctx, pair, rate, amount)
+	}
+	var r0 poloniex.Buy
+	var r1 error
+	return r0, r1
+}
+
+// SellContext calls SellContextFunc
+func (m *Client) SellContext(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error) {
+	m.record("SellContext", ctx, pair, rate, amount)
+	if m.SellContextFunc != nil {
+		return m.SellContextFunc(ctx, pair, rate, amount)
+	}
+	var r0 poloniex.Sell
+	var r1 error
+	return r0, r1
+}
+
+// MoveContext calls MoveContextFunc
+func (m *Client) MoveContext(ctx context.Context, orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error) {
+	m.record("MoveContext", ctx, orderNumber, rate)
+	if m.MoveContextFunc != nil {
+		return m.MoveContextFunc(ctx, orderNumber, rate)
+	}
+	var r0 poloniex.MoveOrder
+	var r1 error
+	return r0, r1
+}
+
+// CancelOrderContext calls CancelOrderContextFunc
+func (m *Client) CancelOrderContext(ctx context.Context, orderNumber int64) (bool, error) {
+	m.record("CancelOrderContext", ctx, orderNumber)
+	if m.CancelOrderContextFunc != nil {
+		return m.CancelOrderContextFunc(ctx, orderNumber)
+	}
+	var r0 bool
+	var r1 error
+	return r0, r1
+}
+
+// BuyPostOnlyContext calls BuyPostOnlyContextFunc
+func (m *Client) BuyPostOnlyContext(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Buy, error) {
+	m.record("BuyPostOnlyContext", ctx, pair, rate, amount)
+	if m.BuyPostOnlyContextFunc != nil {
+		return m.BuyPostOnlyContextFunc(ctx, pair, rate, amount)
+	}
+	var r0 poloniex.Buy
+	var r1 error
+	return r0, r1
+}
+
+// SellPostOnlyContext calls SellPostOnlyContextFunc
+func (m *Client) SellPostOnlyContext(ctx context.Context, pair string, rate ggm.Decimal, amount ggm.Decimal) (poloniex.Sell, error) {
+	m.record("SellPostOnlyContext", ctx, pair, rate, amount)
+	if m.SellPostOnlyContextFunc != nil {
+		return m.SellPostOnlyContextFunc(ctx, pair, rate, amount)
+	}
+	var r0 poloniex.Sell
+	var r1 error
+	return r0, r1
+}
+
+// MovePostOnlyContext calls MovePostOnlyContextFunc
+func (m *Client) MovePostOnlyContext(ctx context.Context, orderNumber int64, rate ggm.Decimal) (poloniex.MoveOrder, error) {
+	m.record("MovePostOnlyContext", ctx, orderNumber, rate)
+	if m.MovePostOnlyContextFunc != nil {
+		return m.MovePostOnlyContextFunc(ctx, orderNumber, rate)
+	}
+	var r0 poloniex.MoveOrder
+	var r1 error
+	return r0, r1
+}
+
+// MarketBuyContext calls MarketBuyContextFunc
+func (m *Client) MarketBuyContext(ctx context.Context, pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error) {
+	m.record("MarketBuyContext", ctx, pair, size, maxSlippage)
+	if m.MarketBuyContextFunc != nil {
+		return m.MarketBuyContextFunc(ctx, pair, size, maxSlippage)
+	}
+	var r0 poloniex.MarketOrder
+	var r1 error
+	return r0, r1
+}
+
+// MarketSellContext calls MarketSellContextFunc
+func (m *Client) MarketSellContext(ctx context.Context, pair string, size poloniex.MarketSize, maxSlippage float64) (poloniex.MarketOrder, error) {
+	m.record("MarketSellContext", ctx, pair, size, maxSlippage)
+	if m.MarketSellContextFunc != nil {
+		return m.MarketSellContextFunc(ctx, pair, size, maxSlippage)
+	}
+	var r0 poloniex.MarketOrder
+	var r1 error
+	return r0, r1
+}
+
+// WithdrawContext calls WithdrawContextFunc
+func (m *Client) WithdrawContext(ctx context.Context, currency string, amount ggm.Decimal, address string) (poloniex.Withdraw, error) {
+	m.record("WithdrawContext", ctx, currency, amount, address)
+	if m.WithdrawContextFunc != nil {
+		return m.WithdrawContextFunc(ctx, currency, amount, address)
+	}
+	var r0 poloniex.Withdraw
+	var r1 error
+	return r0, r1
+}
+
+// WithdrawPaymentIDContext calls WithdrawPaymentIDContextFunc
+func (m *Client) WithdrawPaymentIDContext(ctx context.Context, currency string, amount ggm.Decimal, address string, paymentID string) (poloniex.Withdraw, error) {
+	m.record("WithdrawPaymentIDContext", ctx, currency, amount, address, paymentID)
+	if m.WithdrawPaymentIDContextFunc != nil {
+		return m.WithdrawPaymentIDContextFunc(ctx, currency, amount, address, paymentID)
+	}
+	var r0 poloniex.Withdraw
+	var r1 error
+	return r0, r1
+}
+
+// OpenOrdersContext calls OpenOrdersContextFunc
+func (m *Client) OpenOrdersContext(ctx context.Context, pair string) (poloniex.OpenOrders, error) {
+	m.record("OpenOrdersContext", ctx, pair)
+	if m.OpenOrdersContextFunc != nil {
+		return m.OpenOrdersContextFunc(ctx, pair)
+	}
+	var r0 poloniex.OpenOrders
+	var r1 error
+	return r0, r1
+}
+
+// OrderTradesContext calls OrderTradesContextFunc
+func (m *Client) OrderTradesContext(ctx context.Context, orderNumber int64) (poloniex.OrderTrades, error) {
+	m.record("OrderTradesContext", ctx, orderNumber)
+	if m.OrderTradesContextFunc != nil {
+		return m.OrderTradesContextFunc(ctx, orderNumber)
+	}
+	var r0 poloniex.OrderTrades
+	var r1 error
+	return r0, r1
+}
+
+// LoanOffer calls LoanOfferFunc
+func (m *Client) LoanOffer(currency string, amount ggm.Decimal, duration int, renew bool, lendingRate ggm.Decimal) (poloniex.LoanOffer, error) {
+	m.record("LoanOffer", currency, amount, duration, renew, lendingRate)
+	if m.LoanOfferFunc != nil {
+		return m.LoanOfferFunc(currency, amount, duration, renew, lendingRate)
+	}
+	var r0 poloniex.LoanOffer
+	var r1 error
+	return r0, r1
+}
+
+// CancelLoanOffer calls CancelLoanOfferFunc
+func (m *Client) CancelLoanOffer(orderNumber int64) (bool, error) {
+	m.record("CancelLoanOffer", orderNumber)
+	if m.CancelLoanOfferFunc != nil {
+		return m.CancelLoanOfferFunc(orderNumber)
+	}
+	var r0 bool
+	var r1 error
+	return r0, r1
+}
+
+// OpenLoanOffers calls OpenLoanOffersFunc
+func (m *Client) OpenLoanOffers() (poloniex.OpenLoanOffers, error) {
+	m.record("OpenLoanOffers")
+	if m.OpenLoanOffersFunc != nil {
+		return m.OpenLoanOffersFunc()
+	}
+	var r0 poloniex.OpenLoanOffers
+	var r1 error
+	return r0, r1
+}
+
+// ActiveLoans calls ActiveLoansFunc
+func (m *Client) ActiveLoans() (poloniex.ActiveLoans, error) {
+	m.record("ActiveLoans")
+	if m.ActiveLoansFunc != nil {
+		return m.ActiveLoansFunc()
+	}
+	var r0 poloniex.ActiveLoans
+	var r1 error
+	return r0, r1
+}
+
+// ToggleAutoRenew calls ToggleAutoRenewFunc
+func (m *Client) ToggleAutoRenew(orderNumber int64) (bool, error) {
+	m.record("ToggleAutoRenew", orderNumber)
+	if m.ToggleAutoRenewFunc != nil {
+		return m.ToggleAutoRenewFunc(orderNumber)
+	}
+	var r0 bool
+	var r1 error
+	return r0, r1
+}
+
+// NewTickerSubscription calls NewTickerSubscriptionFunc
+func (m *Client) NewTickerSubscription() (*poloniex.TickerSubscription, error) {
+	m.record("NewTickerSubscription")
+	if m.NewTickerSubscriptionFunc != nil {
+		return m.NewTickerSubscriptionFunc()
+	}
+	var r0 *poloniex.TickerSubscription
+	var r1 error
+	return r0, r1
+}
+
+// NewOrderSubscription calls NewOrderSubscriptionFunc
+func (m *Client) NewOrderSubscription(code string) (*poloniex.OrderSubscription, error) {
+	m.record("NewOrderSubscription", code)
+	if m.NewOrderSubscriptionFunc != nil {
+		return m.NewOrderSubscriptionFunc(code)
+	}
+	var r0 *poloniex.OrderSubscription
+	var r1 error
+	return r0, r1
+}
+
+// NewAccountSubscription calls NewAccountSubscriptionFunc
+func (m *Client) NewAccountSubscription() (*poloniex.AccountSubscription, error) {
+	m.record("NewAccountSubscription")
+	if m.NewAccountSubscriptionFunc != nil {
+		return m.NewAccountSubscriptionFunc()
+	}
+	var r0 *poloniex.AccountSubscription
+	var r1 error
+	return r0, r1
+}
+
+// NewDailyVolumeSubscription calls NewDailyVolumeSubscriptionFunc
+func (m *Client) NewDailyVolumeSubscription() (*poloniex.DailyVolumeSubscription, error) {
+	m.record("NewDailyVolumeSubscription")
+	if m.NewDailyVolumeSubscriptionFunc != nil {
+		return m.NewDailyVolumeSubscriptionFunc()
+	}
+	var r0 *poloniex.DailyVolumeSubscription
+	var r1 error
+	return r0, r1
+}
+
+// SubscribeTicker calls SubscribeTickerFunc
+func (m *Client) SubscribeTicker() poloniex.WSTickerChan {
+	m.record("SubscribeTicker")
+	if m.SubscribeTickerFunc != nil {
+		return m.SubscribeTickerFunc()
+	}
+	var r0 poloniex.WSTickerChan
+	return r0
+}
+
+// SubscribeOrder calls SubscribeOrderFunc
+func (m *Client) SubscribeOrder(code string) poloniex.WSOrderOrTradeChan {
+	m.record("SubscribeOrder", code)
+	if m.SubscribeOrderFunc != nil {
+		return m.SubscribeOrderFunc(code)
+	}
+	var r0 poloniex.WSOrderOrTradeChan
+	return r0
+}
+
+// UnsubscribeTicker calls UnsubscribeTickerFunc
+func (m *Client) UnsubscribeTicker() {
+	m.record("UnsubscribeTicker")
+	if m.UnsubscribeTickerFunc != nil {
+		m.UnsubscribeTickerFunc()
+	}
+}
+
+// UnsubscribeOrder calls UnsubscribeOrderFunc
+func (m *Client) UnsubscribeOrder(code string) {
+	m.record("UnsubscribeOrder", code)
+	if m.UnsubscribeOrderFunc != nil {
+		m.UnsubscribeOrderFunc(code)
+	}
+}
+
+// Unsubscribe calls UnsubscribeFunc
+func (m *Client) Unsubscribe(code string) {
+	m.record("Unsubscribe", code)
+	if m.UnsubscribeFunc != nil {
+		m.UnsubscribeFunc(code)
+	}
+}
+
+// MonitorHeartbeat calls MonitorHeartbeatFunc
+func (m *Client) MonitorHeartbeat(timeout time.Duration) {
+	m.record("MonitorHeartbeat", timeout)
+	if m.MonitorHeartbeatFunc != nil {
+		m.MonitorHeartbeatFunc(timeout)
+	}
+}
+
+// LastMessageAge calls LastMessageAgeFunc
+func (m *Client) LastMessageAge() (time.Duration, bool) {
+	m.record("LastMessageAge")
+	if m.LastMessageAgeFunc != nil {
+		return m.LastMessageAgeFunc()
+	}
+	var r0 time.Duration
+	var r1 bool
+	return r0, r1
+}
+
+// Close calls CloseFunc
+func (m *Client) Close() error {
+	m.record("Close")
+	if m.CloseFunc != nil {
+		return m.CloseFunc()
+	}
+	var r0 error
+	return r0
+}
+
+// Shutdown calls ShutdownFunc
+func (m *Client) Shutdown(ctx context.Context) error {
+	m.record("Shutdown", ctx)
+	if m.ShutdownFunc != nil {
+		return m.ShutdownFunc(ctx)
+	}
+	var r0 error
+	return r0
+}
@@ -0,0 +1,45 @@
+package poloniexmock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/hhh0pE/poloniex-api"
+)
+
+func TestClient(t *testing.T) {
+	m := &Client{
+		BuyFunc: func(pair string, rate, amount ggm.Decimal) (poloniex.Buy, error) {
+			return poloniex.Buy{OrderNumber: 42}, nil
+		},
+	}
+	var api poloniex.TradingAPI = m
+	rate, _ := ggm.NewDecimalFromString("0.031")
+	b, err := api.Buy("BTC_ETH", rate, rate)
+	if err != nil || b.OrderNumber != 42 {
+		t.Fatalf("unexpected buy %+v %v", b, err)
+	}
+	if _, err := api.CancelOrder(42); err != nil {
+		t.Fatal(err)
+	}
+	if c := m.Calls("Buy"); len(c) != 1 || c[0].Args[0] != "BTC_ETH" {
+		t.Errorf("unexpected calls %+v", c)
+	}
+	if c := m.Calls(""); len(c) != 2 || c[1].Method != "CancelOrder" || c[1].Args[0] != int64(42) {
+		t.Errorf("unexpected calls %+v", c)
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	ch := make(poloniex.WSTickerChan)
+	m := &Client{SubscribeTickerFunc: func() poloniex.WSTickerChan { return ch }}
+	var api poloniex.StreamAPI = m
+	if api.SubscribeTicker() != ch {
+		t.Error("ticker channel not returned")
+	}
+	api.MonitorHeartbeat(time.Second)
+	if c := m.Calls("MonitorHeartbeat"); len(c) != 1 || c[0].Args[0] != time.Second {
+		t.Errorf("unexpected calls %+v", c)
+	}
+}
@@ -0,0 +1,80 @@
+// Package poloniexotel exports the metrics and traces of a poloniex client to OpenTelemetry
+package poloniexotel
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type (
+	// Metrics is a poloniex.Metrics recording into OpenTelemetry instruments named poloniex.*
+	Metrics struct {
+		requests      metric.Float64Histogram
+		errors        metric.Int64Counter
+		rateLimitWait metric.Float64Histogram
+		reconnects    metric.Int64Counter
+		messages      metric.Int64Counter
+		lag           metric.Float64Histogram
+	}
+)
+
+// New creates the instruments with meter, hand the result to Poloniex.SetMetrics
+func New(meter metric.Meter) (m *Metrics, err error) {
+	m = &Metrics{}
+	if m.requests, err = meter.Float64Histogram("poloniex.request.duration",
+		metric.WithUnit("s"), metric.WithDescription("Latency of REST calls by API and command.")); err != nil {
+		return nil, err
+	}
+	if m.errors, err = meter.Int64Counter("poloniex.request.errors",
+		metric.WithDescription("Failed REST calls by command and error kind.")); err != nil {
+		return nil, err
+	}
+	if m.rateLimitWait, err = meter.Float64Histogram("poloniex.rate_limit.wait",
+		metric.WithUnit("s"), metric.WithDescription("Time REST calls waited for the rate limiter.")); err != nil {
+		return nil, err
+	}
+	if m.reconnects, err = meter.Int64Counter("poloniex.ws.reconnects",
+		metric.WithDescription("Websocket reconnects by feed.")); err != nil {
+		return nil, err
+	}
+	if m.messages, err = meter.Int64Counter("poloniex.ws.messages",
+		metric.WithDescription("Websocket messages handed to subscribers by topic.")); err != nil {
+		return nil, err
+	}
+	if m.lag, err = meter.Float64Histogram("poloniex.ws.message_lag",
+		metric.WithUnit("s"), metric.WithDescription("Age of timestamped websocket messages on arrival by topic.")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ObserveRequest implements poloniex.Metrics
+func (m *Metrics) ObserveRequest(api, command string, latency time.Duration, errorKind string) {
+	ctx := context.Background()
+	m.requests.Record(ctx, latency.Seconds(), metric.WithAttributes(attribute.String("api", api), attribute.String("command", command)))
+	if errorKind != "" {
+		m.errors.Add(ctx, 1, metric.WithAttributes(attribute.String("command", command), attribute.String("kind", errorKind)))
+	}
+}
+
+// ObserveRateLimitWait implements poloniex.Metrics
+func (m *Metrics) ObserveRateLimitWait(wait time.Duration) {
+	m.rateLimitWait.Record(context.Background(), wait.Seconds())
+}
+
+// ObserveReconnect implements poloniex.Metrics
+func (m *Metrics) ObserveReconnect(feed string) {
+	m.reconnects.Add(context.Background(), 1, metric.WithAttributes(attribute.String("feed", feed)))
+}
+
+// ObserveMessage implements poloniex.Metrics
+func (m *Metrics) ObserveMessage(topic string, lag time.Duration) {
+	attrs := metric.WithAttributes(attribute.String("topic", topic))
+	m.messages.Add(context.Background(), 1, attrs)
+	if lag >= 0 {
+		m.lag.Record(context.Background(), lag.Seconds(), attrs)
+	}
+}
@@ -0,0 +1,41 @@
+package poloniexotel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hhh0pE/poloniex-api"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+var _ poloniex.Metrics = (*Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m, err := New(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("poloniex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ObserveRequest("public", "returnTicker", 50*time.Millisecond, "")
+	m.ObserveRequest("private", "buy", 90*time.Millisecond, "insufficient_funds")
+	m.ObserveReconnect("push")
+	m.ObserveMessage("BTC_ETH", time.Second)
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+		}
+	}
+	for _, n := range []string{"poloniex.request.duration", "poloniex.request.errors", "poloniex.ws.reconnects", "poloniex.ws.messages", "poloniex.ws.message_lag"} {
+		if !names[n] {
+			t.Errorf("no %s in %v", n, names)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package poloniexotel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hhh0pE/poloniex-api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// Tracer is a poloniex.Tracer starting client spans with an OpenTelemetry tracer
+	Tracer struct {
+		tracer trace.Tracer
+	}
+
+	span struct {
+		span trace.Span
+	}
+)
+
+// NewTracer adapts tracer, hand the result to Poloniex.SetTracer
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start implements poloniex.Tracer
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, poloniex.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes(attrs)...))
+	return ctx, span{s}
+}
+
+// SetAttributes implements poloniex.Span
+func (s span) SetAttributes(attrs ...interface{}) {
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+// End implements poloniex.Span, a failed call records err and sets the error status
+func (s span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// attributes turns alternating keys and values into attributes, a key without value is dropped
+func attributes(kv []interface{}) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		k := attribute.Key(fmt.Sprint(kv[i]))
+		switch v := kv[i+1].(type) {
+		case string:
+			attrs = append(attrs, k.String(v))
+		case int:
+			attrs = append(attrs, k.Int(v))
+		case int64:
+			attrs = append(attrs, k.Int64(v))
+		case float64:
+			attrs = append(attrs, k.Float64(v))
+		case bool:
+			attrs = append(attrs, k.Bool(v))
+		default:
+			attrs = append(attrs, k.String(fmt.Sprint(v)))
+		}
+	}
+	return attrs
+}
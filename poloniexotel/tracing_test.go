@@ -0,0 +1,48 @@
+package poloniexotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hhh0pE/poloniex-api"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ poloniex.Tracer = (*Tracer)(nil)
+
+func TestTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tr := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("poloniex"))
+
+	ctx, parent := tr.Start(context.Background(), "strategy", "poloniex.pair", "BTC_ETH")
+	_, s := tr.Start(ctx, "poloniex.buy", "poloniex.command", "buy")
+	s.SetAttributes("http.status_code", 200)
+	s.End(errors.New("Not enough BTC."))
+	parent.End(nil)
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans", len(spans))
+	}
+	buy := spans[0]
+	if buy.Name() != "poloniex.buy" || buy.SpanKind() != trace.SpanKindClient {
+		t.Errorf("span %s of kind %v", buy.Name(), buy.SpanKind())
+	}
+	if buy.Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Error("buy isn't a child of the strategy span")
+	}
+	if buy.Status().Code != codes.Error || len(buy.Events()) != 1 {
+		t.Errorf("status %v, events %v", buy.Status(), buy.Events())
+	}
+	attrs := map[string]string{}
+	for _, a := range buy.Attributes() {
+		attrs[string(a.Key)] = a.Value.Emit()
+	}
+	if attrs["poloniex.command"] != "buy" || attrs["http.status_code"] != "200" {
+		t.Errorf("attributes %v", attrs)
+	}
+}
@@ -0,0 +1,89 @@
+// Package poloniexprom exports the metrics of a poloniex client to Prometheus
+package poloniexprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Metrics is a poloniex.Metrics collecting into Prometheus metrics named poloniex_*
+	Metrics struct {
+		requests      *prometheus.HistogramVec
+		errors        *prometheus.CounterVec
+		rateLimitWait prometheus.Histogram
+		reconnects    *prometheus.CounterVec
+		messages      *prometheus.CounterVec
+		lag           *prometheus.HistogramVec
+	}
+)
+
+// New registers the metrics with reg, prometheus.DefaultRegisterer when nil. Hand the result to
+// Poloniex.SetMetrics.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	m := &Metrics{
+		requests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "poloniex_request_duration_seconds",
+			Help:    "Latency of REST calls by API and command.",
+			Buckets: prometheus.ExponentialBuckets(0.025, 2, 10),
+		}, []string{"api", "command"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "poloniex_request_errors_total",
+			Help: "Failed REST calls by command and error kind.",
+		}, []string{"command", "kind"}),
+		rateLimitWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "poloniex_rate_limit_wait_seconds",
+			Help:    "Time REST calls waited for the rate limiter.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 10),
+		}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "poloniex_ws_reconnects_total",
+			Help: "Websocket reconnects by feed.",
+		}, []string{"feed"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "poloniex_ws_messages_total",
+			Help: "Websocket messages handed to subscribers by topic.",
+		}, []string{"topic"}),
+		lag: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "poloniex_ws_message_lag_seconds",
+			Help:    "Age of timestamped websocket messages on arrival by topic.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+		}, []string{"topic"}),
+	}
+	for _, c := range []prometheus.Collector{m.requests, m.errors, m.rateLimitWait, m.reconnects, m.messages, m.lag} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveRequest implements poloniex.Metrics
+func (m *Metrics) ObserveRequest(api, command string, latency time.Duration, errorKind string) {
+	m.requests.WithLabelValues(api, command).Observe(latency.Seconds())
+	if errorKind != "" {
+		m.errors.WithLabelValues(command, errorKind).Inc()
+	}
+}
+
+// ObserveRateLimitWait implements poloniex.Metrics
+func (m *Metrics) ObserveRateLimitWait(wait time.Duration) {
+	m.rateLimitWait.Observe(wait.Seconds())
+}
+
+// ObserveReconnect implements poloniex.Metrics
+func (m *Metrics) ObserveReconnect(feed string) {
+	m.reconnects.WithLabelValues(feed).Inc()
+}
+
+// ObserveMessage implements poloniex.Metrics
+func (m *Metrics) ObserveMessage(topic string, lag time.Duration) {
+	m.messages.WithLabelValues(topic).Inc()
+	if lag >= 0 {
+		m.lag.WithLabelValues(topic).Observe(lag.Seconds())
+	}
+}
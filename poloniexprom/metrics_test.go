@@ -0,0 +1,42 @@
+package poloniexprom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hhh0pE/poloniex-api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var _ poloniex.Metrics = (*Metrics)(nil)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ObserveRequest("private", "buy", 80*time.Millisecond, "")
+	m.ObserveRequest("private", "buy", 90*time.Millisecond, "nonce")
+	m.ObserveRateLimitWait(10 * time.Millisecond)
+	m.ObserveReconnect("push")
+	m.ObserveMessage("BTC_ETH", time.Second)
+	m.ObserveMessage("ticker", -1)
+
+	if n := testutil.CollectAndCount(m.requests); n != 1 {
+		t.Errorf("%d request series", n)
+	}
+	if v := testutil.ToFloat64(m.errors.WithLabelValues("buy", "nonce")); v != 1 {
+		t.Errorf("%v nonce errors", v)
+	}
+	if v := testutil.ToFloat64(m.messages.WithLabelValues("ticker")); v != 1 {
+		t.Errorf("%v ticker messages", v)
+	}
+	if n := testutil.CollectAndCount(m.lag); n != 1 {
+		t.Errorf("%d lag series, untimestamped messages have no lag", n)
+	}
+	if _, err := New(reg); err == nil {
+		t.Error("metrics registered twice")
+	}
+}
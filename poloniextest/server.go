@@ -0,0 +1,572 @@
+// Package poloniextest provides an in-process fake Poloniex for tests: the public commands, HMAC verified
+// private commands backed by an in-memory matching engine and balances, and scriptable websocket feeds.
+//
+//	srv := poloniextest.NewServer()
+//	defer srv.Close()
+//	srv.SetBalance("BTC", 1)
+//	srv.SetOrderBook("BTC_ETH", []poloniextest.Level{{Rate: 0.031, Amount: 10}}, nil)
+//	p := poloniex.NewWithCredentials(srv.Key, srv.Secret)
+//	p.UseEndpoints(poloniex.Endpoints{Public: srv.PublicURL, Private: srv.PrivateURL, WS: srv.WSURL, Push: srv.PushURL})
+package poloniextest
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/poloniex-api/internal/sim"
+	"gopkg.in/beatgammit/turnpike.v2"
+)
+
+type (
+	// Level is a price level of an order book
+	Level struct {
+		Rate   float64
+		Amount float64
+	}
+
+	// Ticker is the ticker of a pair
+	Ticker struct {
+		Last          float64
+		LowestAsk     float64
+		HighestBid    float64
+		PercentChange float64
+		BaseVolume    float64
+		QuoteVolume   float64
+		High24hr      float64
+		Low24hr       float64
+		IsFrozen      bool
+	}
+
+	// Currency describes a currency
+	Currency struct {
+		ID       int64
+		Name     string
+		TxFee    float64
+		MinConf  int64
+		Disabled bool
+		Delisted bool
+		Frozen   bool
+	}
+
+	// Trade is a public trade of a pair
+	Trade struct {
+		ID     int64
+		Date   time.Time
+		Type   string
+		Rate   float64
+		Amount float64
+	}
+
+	// Candle is a chart data entry of a pair
+	Candle struct {
+		Date            time.Time
+		High            float64
+		Low             float64
+		Open            float64
+		Close           float64
+		Volume          float64
+		QuoteVolume     float64
+		WeightedAverage float64
+	}
+
+	// Transfer is a deposit to or a withdrawal from the account
+	Transfer struct {
+		Number    int64
+		Currency  string
+		Address   string
+		PaymentID string
+		Amount    float64
+		Time      time.Time
+	}
+
+	// Server is a fake Poloniex listening on a local port
+	Server struct {
+		// Key and Secret are the only credentials the private API accepts
+		Key    string
+		Secret string
+
+		PublicURL  string
+		PrivateURL string
+		WSURL      string
+		PushURL    string
+
+		http     *httptest.Server
+		exchange *sim.Exchange
+		wamp     *turnpike.WebsocketServer
+		local    *turnpike.Client
+
+		mu         sync.Mutex
+		nonce      int64
+		tickers    map[string]Ticker
+		currencies map[string]Currency
+		trades     map[string][]Trade
+		candles    map[string][]Candle
+		frozen     map[string]bool
+		addresses  map[string]string
+		deposits   []Transfer
+		withdrawn  []Transfer
+		loans      int64
+		push       map[*pushConn]bool
+	}
+)
+
+// NewServer starts a fake Poloniex, Close it when done
+func NewServer() *Server {
+	s := &Server{
+		Key:        "poloniextest-key",
+		Secret:     "poloniextest-secret",
+		exchange:   sim.New(),
+		tickers:    map[string]Ticker{},
+		currencies: map[string]Currency{},
+		trades:     map[string][]Trade{},
+		candles:    map[string][]Candle{},
+		frozen:     map[string]bool{},
+		addresses:  map[string]string{},
+		push:       map[*pushConn]bool{},
+	}
+	s.wamp = turnpike.NewBasicWebsocketServer("realm1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/public", s.servePublic)
+	mux.HandleFunc("/tradingApi", s.servePrivate)
+	mux.Handle("/ws", s.wamp)
+	mux.HandleFunc("/push", s.servePush)
+	s.http = httptest.NewServer(mux)
+
+	ws := "ws" + strings.TrimPrefix(s.http.URL, "http")
+	s.PublicURL = s.http.URL + "/public"
+	s.PrivateURL = s.http.URL + "/tradingApi"
+	s.WSURL = ws + "/ws"
+	s.PushURL = ws + "/push"
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.mu.Lock()
+	for c := range s.push {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	if s.local != nil {
+		s.local.Close()
+	}
+	s.wamp.Close()
+	s.http.Close()
+}
+
+// SetFees sets the maker and taker fee of the account
+func (s *Server) SetFees(maker, taker float64) {
+	s.exchange.MakerFee = maker
+	s.exchange.TakerFee = taker
+}
+
+// SetBalance sets the available amount of currency on the account
+func (s *Server) SetBalance(currency string, amount float64) {
+	s.exchange.SetBalance(currency, amount)
+}
+
+// Deposit credits amount of currency to the account as a deposit to address at t
+func (s *Server) Deposit(currency, address string, amount float64, t time.Time) {
+	s.mu.Lock()
+	s.deposits = append(s.deposits, Transfer{Currency: currency, Address: address, Amount: amount, Time: t})
+	s.mu.Unlock()
+	s.exchange.SetBalance(currency, s.exchange.Balances()[currency].Available+amount)
+}
+
+// Withdrawals returns the withdrawals made from the account
+func (s *Server) Withdrawals() []Transfer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Transfer(nil), s.withdrawn...)
+}
+
+// SetOrderBook replaces the liquidity of pair others have put on the book
+func (s *Server) SetOrderBook(pair string, asks, bids []Level) {
+	s.exchange.SetBook(pair, toSim(asks), toSim(bids))
+}
+
+// SetFrozen marks pair as frozen in the order book and ticker
+func (s *Server) SetFrozen(pair string, frozen bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frozen[pair] = frozen
+}
+
+// SetTicker sets the ticker of pair
+func (s *Server) SetTicker(pair string, t Ticker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tickers[pair] = t
+}
+
+// SetCurrency sets the description of currency
+func (s *Server) SetCurrency(currency string, c Currency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.currencies[currency] = c
+}
+
+// SetTradeHistory sets the public trades of pair, newest first
+func (s *Server) SetTradeHistory(pair string, trades []Trade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trades[pair] = trades
+}
+
+// SetChartData sets the candles of pair, oldest first
+func (s *Server) SetChartData(pair string, candles []Candle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.candles[pair] = candles
+}
+
+// Trade reports a trade by someone else that took amount at rate from side of the book of pair,
+// resting orders of the account on that side are filled as makers
+func (s *Server) Trade(pair, side string, rate, amount float64) {
+	sd := sim.Buy
+	if side == "sell" {
+		sd = sim.Sell
+	}
+	s.exchange.Trade(pair, sd, rate, amount)
+}
+
+func toSim(levels []Level) []sim.Level {
+	l := make([]sim.Level, len(levels))
+	for i := range levels {
+		l[i] = sim.Level{Rate: levels[i].Rate, Amount: levels[i].Amount}
+	}
+	return l
+}
+
+func f8(x float64) string {
+	return sim.F8(x)
+}
+
+func b01(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, msg string) {
+	writeJSON(w, sim.Error(msg))
+}
+
+func (s *Server) servePublic(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pair := q.Get("currencyPair")
+	switch q.Get("command") {
+	case "returnTicker":
+		writeJSON(w, s.ticker())
+	case "return24hVolume":
+		writeJSON(w, s.volume())
+	case "returnOrderBook":
+		depth, _ := strconv.Atoi(q.Get("depth"))
+		if pair == "all" {
+			all := map[string]interface{}{}
+			for _, p := range s.pairs() {
+				all[p] = s.orderBook(p, depth)
+			}
+			writeJSON(w, all)
+			return
+		}
+		writeJSON(w, s.orderBook(pair, depth))
+	case "returnTradeHistory":
+		s.mu.Lock()
+		trades := []map[string]interface{}{}
+		for _, t := range s.trades[pair] {
+			trades = append(trades, map[string]interface{}{
+				"globalTradeID": t.ID,
+				"tradeID":       t.ID,
+				"date":          t.Date.UTC().Format(sim.DateFormat),
+				"type":          t.Type,
+				"rate":          f8(t.Rate),
+				"amount":        f8(t.Amount),
+				"total":         f8(sim.Round(t.Rate * t.Amount)),
+			})
+		}
+		s.mu.Unlock()
+		writeJSON(w, trades)
+	case "returnChartData":
+		start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+		s.mu.Lock()
+		candles := []map[string]interface{}{}
+		for _, c := range s.candles[pair] {
+			if c.Date.Unix() < start || (end > 0 && c.Date.Unix() > end) {
+				continue
+			}
+			candles = append(candles, map[string]interface{}{
+				"date":            c.Date.Unix(),
+				"high":            c.High,
+				"low":             c.Low,
+				"open":            c.Open,
+				"close":           c.Close,
+				"volume":          c.Volume,
+				"quoteVolume":     c.QuoteVolume,
+				"weightedAverage": c.WeightedAverage,
+			})
+		}
+		s.mu.Unlock()
+		writeJSON(w, candles)
+	case "returnCurrencies":
+		s.mu.Lock()
+		currencies := map[string]interface{}{}
+		for k, c := range s.currencies {
+			currencies[k] = map[string]interface{}{
+				"id":             c.ID,
+				"name":           c.Name,
+				"txFee":          f8(c.TxFee),
+				"minConf":        c.MinConf,
+				"depositAddress": nil,
+				"disabled":       b01(c.Disabled),
+				"delisted":       b01(c.Delisted),
+				"frozen":         b01(c.Frozen),
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, currencies)
+	case "returnLoanOrders":
+		writeJSON(w, map[string]interface{}{"offers": []interface{}{}, "demands": []interface{}{}})
+	default:
+		writeError(w, "Invalid command.")
+	}
+}
+
+// pairs returns every pair with a ticker or a book, sorted
+func (s *Server) pairs() []string {
+	s.mu.Lock()
+	seen := map[string]bool{}
+	for p := range s.tickers {
+		seen[p] = true
+	}
+	s.mu.Unlock()
+	for _, p := range s.exchange.Pairs() {
+		seen[p] = true
+	}
+	pairs := []string{}
+	for p := range seen {
+		pairs = append(pairs, p)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func (s *Server) ticker() map[string]interface{} {
+	s.mu.Lock()
+	tickers := map[string]Ticker{}
+	for k, v := range s.tickers {
+		tickers[k] = v
+	}
+	s.mu.Unlock()
+	all := map[string]interface{}{}
+	for pair, t := range tickers {
+		asks, bids := s.exchange.Book(pair)
+		if t.LowestAsk == 0 && len(asks) > 0 {
+			t.LowestAsk = asks[0].Rate
+		}
+		if t.HighestBid == 0 && len(bids) > 0 {
+			t.HighestBid = bids[0].Rate
+		}
+		all[pair] = map[string]interface{}{
+			"last":          f8(t.Last),
+			"lowestAsk":     f8(t.LowestAsk),
+			"highestBid":    f8(t.HighestBid),
+			"percentChange": f8(t.PercentChange),
+			"baseVolume":    f8(t.BaseVolume),
+			"quoteVolume":   f8(t.QuoteVolume),
+			"isFrozen":      strconv.Itoa(b01(t.IsFrozen || s.isFrozen(pair))),
+			"high24hr":      f8(t.High24hr),
+			"low24hr":       f8(t.Low24hr),
+		}
+	}
+	return all
+}
+
+func (s *Server) volume() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := map[string]interface{}{}
+	totals := map[string]float64{}
+	for pair, t := range s.tickers {
+		base, quote := sim.Split(pair)
+		all[pair] = map[string]string{base: f8(t.BaseVolume), quote: f8(t.QuoteVolume)}
+		totals[base] += t.BaseVolume
+	}
+	for c, v := range totals {
+		all["total"+c] = f8(v)
+	}
+	return all
+}
+
+func (s *Server) isFrozen(pair string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frozen[pair]
+}
+
+func (s *Server) orderBook(pair string, depth int) map[string]interface{} {
+	asks, bids := s.exchange.Book(pair)
+	levels := func(l []sim.Level) [][]interface{} {
+		out := [][]interface{}{}
+		for i := range l {
+			if depth > 0 && i >= depth {
+				break
+			}
+			out = append(out, []interface{}{f8(l[i].Rate), l[i].Amount})
+		}
+		return out
+	}
+	return map[string]interface{}{
+		"asks":     levels(asks),
+		"bids":     levels(bids),
+		"isFrozen": strconv.Itoa(b01(s.isFrozen(pair))),
+		"seq":      1,
+	}
+}
+
+// authenticate checks the Key and Sign headers and the nonce of a private request
+func (s *Server) authenticate(r *http.Request, body []byte, form url.Values) string {
+	if r.Header.Get("Key") != s.Key {
+		return "Invalid API key/secret pair."
+	}
+	mac := hmac.New(sha512.New, []byte(s.Secret))
+	mac.Write(body)
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(r.Header.Get("Sign"))) {
+		return "Invalid API key/secret pair."
+	}
+	nonce, err := strconv.ParseInt(form.Get("nonce"), 10, 64)
+	if err != nil {
+		return "Missing nonce."
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if nonce <= s.nonce {
+		return "Nonce must be greater than " + strconv.FormatInt(s.nonce, 10) + ". You provided " + strconv.FormatInt(nonce, 10) + "."
+	}
+	s.nonce = nonce
+	return ""
+}
+
+func (s *Server) servePrivate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid command.")
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, err.Error())
+		return
+	}
+	if msg := s.authenticate(r, body, form); msg != "" {
+		writeError(w, msg)
+		return
+	}
+	s.trading(w, form)
+}
+
+func (s *Server) trading(w http.ResponseWriter, form url.Values) {
+	command := form.Get("command")
+	if (command == "buy" || command == "sell") && s.isFrozen(form.Get("currencyPair")) {
+		writeError(w, "This market is frozen.")
+		return
+	}
+	if sim.Commands[command] {
+		writeJSON(w, s.exchange.Command(form))
+		return
+	}
+
+	switch command {
+	case "returnDepositAddresses":
+		s.mu.Lock()
+		addresses := map[string]string{}
+		for c, a := range s.addresses {
+			addresses[c] = a
+		}
+		s.mu.Unlock()
+		writeJSON(w, addresses)
+	case "generateNewAddress":
+		currency := form.Get("currency")
+		s.mu.Lock()
+		s.addresses[currency] = "poloniextest-" + strings.ToLower(currency) + "-" + strconv.Itoa(len(s.addresses)+1)
+		address := s.addresses[currency]
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"success": 1, "response": address})
+	case "returnDepositsWithdrawals":
+		start, _ := strconv.ParseInt(form.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(form.Get("end"), 10, 64)
+		in := func(t Transfer) bool { return t.Time.Unix() >= start && t.Time.Unix() <= end }
+		deposits, withdrawals := []interface{}{}, []interface{}{}
+		s.mu.Lock()
+		for _, t := range s.deposits {
+			if in(t) {
+				deposits = append(deposits, map[string]interface{}{"currency": t.Currency, "address": t.Address,
+					"amount": f8(t.Amount), "confirmations": 1, "txid": "poloniextest", "timestamp": t.Time.Unix(), "status": "COMPLETE"})
+			}
+		}
+		for _, t := range s.withdrawn {
+			if in(t) {
+				withdrawals = append(withdrawals, map[string]interface{}{"withdrawalNumber": t.Number, "currency": t.Currency,
+					"address": t.Address, "amount": f8(t.Amount), "timestamp": t.Time.Unix(), "status": "COMPLETE: poloniextest"})
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"deposits": deposits, "withdrawals": withdrawals})
+	case "withdraw":
+		currency := form.Get("currency")
+		amount, _ := strconv.ParseFloat(form.Get("amount"), 64)
+		if form.Get("address") == "" || amount <= 0 {
+			writeError(w, "Invalid withdrawal.")
+			return
+		}
+		available := s.exchange.Balances()[currency].Available
+		if amount > available {
+			writeError(w, "Not enough "+currency+".")
+			return
+		}
+		s.exchange.SetBalance(currency, available-amount)
+		s.mu.Lock()
+		t := Transfer{Number: int64(len(s.withdrawn) + 1), Currency: currency, Address: form.Get("address"),
+			PaymentID: form.Get("paymentId"), Amount: amount, Time: time.Now()}
+		s.withdrawn = append(s.withdrawn, t)
+		s.mu.Unlock()
+		// like Poloniex, the withdrawal number is only in the history
+		writeJSON(w, map[string]interface{}{"response": "Withdrew " + f8(amount) + " " + currency + "."})
+	case "createLoanOffer":
+		s.mu.Lock()
+		s.loans++
+		id := s.loans
+		s.mu.Unlock()
+		writeJSON(w, map[string]interface{}{"success": 1, "message": "Loan order placed.", "orderID": id})
+	case "returnOpenLoanOffers":
+		writeJSON(w, map[string]interface{}{})
+	case "returnActiveLoans":
+		writeJSON(w, map[string]interface{}{"provided": []interface{}{}, "used": []interface{}{}})
+	case "toggleAutoRenew":
+		writeJSON(w, map[string]interface{}{"success": 1, "message": 0})
+	default:
+		writeError(w, "Invalid command.")
+	}
+}
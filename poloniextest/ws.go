@@ -0,0 +1,145 @@
+package poloniextest
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/hhh0pE/poloniex-api/internal/sim"
+)
+
+type pushConn struct {
+	conn     *websocket.Conn
+	mu       sync.Mutex
+	channels map[int]bool
+}
+
+var upgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+// Publish sends an event to the subscribers of a topic of the WAMP feed, e.g. "ticker" or "BTC_ETH"
+func (s *Server) Publish(topic string, args []interface{}, kwargs map[string]interface{}) error {
+	s.mu.Lock()
+	if s.local == nil {
+		c, err := s.wamp.GetLocalClient("realm1", nil)
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.local = c
+	}
+	c := s.local
+	s.mu.Unlock()
+	return c.Publish(topic, args, kwargs)
+}
+
+// PublishTicker sends t as an update of the ticker of pair over the WAMP feed
+func (s *Server) PublishTicker(pair string, t Ticker) error {
+	return s.Publish("ticker", []interface{}{
+		pair, f8(t.Last), f8(t.LowestAsk), f8(t.HighestBid), f8(t.PercentChange / 100),
+		f8(t.BaseVolume), f8(t.QuoteVolume), b01(t.IsFrozen), f8(t.High24hr), f8(t.Low24hr),
+	}, nil)
+}
+
+// PublishTrade sends a newTrade event for pair over the WAMP feed
+func (s *Server) PublishTrade(pair string, seq int64, t Trade) error {
+	return s.Publish(pair, []interface{}{map[string]interface{}{
+		"type": "newTrade",
+		"data": map[string]interface{}{
+			"tradeID": strconv.FormatInt(t.ID, 10),
+			"rate":    f8(t.Rate),
+			"amount":  f8(t.Amount),
+			"type":    t.Type,
+			"date":    t.Date.UTC().Format(sim.DateFormat),
+		},
+	}}, map[string]interface{}{"seq": seq})
+}
+
+// Push sends msg to every push connection subscribed to its channel, msg[0], e.g.
+// Push(1000, "", []interface{}{[]interface{}{"b", 28, "e", "-0.06000000"}})
+func (s *Server) Push(msg ...interface{}) {
+	channel, _ := msg[0].(int)
+	s.mu.Lock()
+	conns := []*pushConn{}
+	for c := range s.push {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.mu.Lock()
+		if c.channels[channel] || channel == 1010 {
+			c.conn.WriteJSON(msg)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Heartbeat sends a heartbeat over every push connection
+func (s *Server) Heartbeat() {
+	s.Push(1010)
+}
+
+// DropPushConnections closes every push connection, as when the exchange goes away
+func (s *Server) DropPushConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.push {
+		c.conn.Close()
+		delete(s.push, c)
+	}
+}
+
+func (s *Server) servePush(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &pushConn{conn: conn, channels: map[int]bool{}}
+	s.mu.Lock()
+	s.push[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.push, c)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		cmd := struct {
+			Command string
+			Channel int
+			Key     string
+			Payload string
+			Sign    string
+		}{}
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		c.mu.Lock()
+		switch cmd.Command {
+		case "subscribe":
+			if cmd.Channel == 1000 && !s.verifyPush(cmd.Key, cmd.Payload, cmd.Sign) {
+				conn.WriteJSON(map[string]string{"error": "Permission denied."})
+				break
+			}
+			c.channels[cmd.Channel] = true
+			conn.WriteJSON([]interface{}{cmd.Channel, 1})
+		case "unsubscribe":
+			delete(c.channels, cmd.Channel)
+			conn.WriteJSON([]interface{}{cmd.Channel, 0})
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (s *Server) verifyPush(key, payload, sign string) bool {
+	if key != s.Key {
+		return false
+	}
+	mac := hmac.New(sha512.New, []byte(s.Secret))
+	mac.Write([]byte(payload))
+	return hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(sign))
+}
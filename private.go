@@ -1,19 +1,18 @@
 package poloniex
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/franela/goreq"
 	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
 )
 
 type (
@@ -124,6 +123,9 @@ type (
 
 	Withdraw struct {
 		Base
+		WithdrawalNumber int64 `json:"withdrawalNumber"`
+		// LookupError is why WithdrawalNumber is 0 although the withdrawal went through
+		LookupError error `json:"-"`
 	}
 
 	FeeInfo struct {
@@ -199,13 +201,13 @@ type (
 )
 
 func (p *Poloniex) Balances() (balances Balances, err error) {
-	p.private("returnCompleteBalances", nil, &balances)
+	err = p.private("returnCompleteBalances", nil, &balances)
 	return
 }
 
 func (p *Poloniex) AccountBalances() (balances AccountBalances, err error) {
 	b := AccountBalancesTemp{}
-	p.private("returnAvailableAccountBalances", nil, &b)
+	err = p.private("returnAvailableAccountBalances", nil, &b)
 	balances = AccountBalances{Exchange: map[string]ggm.Decimal{}, Margin: map[string]ggm.Decimal{}, Lending: map[string]ggm.Decimal{}}
 	for k, v := range b.Exchange {
 		balances.Exchange[k], _ = ggm.NewDecimalFromString(v)
@@ -223,7 +225,7 @@ func (p *Poloniex) AccountBalances() (balances AccountBalances, err error) {
 }
 
 func (p *Poloniex) Addresses() (addresses Addresses, err error) {
-	p.private("returnDepositAddresses", nil, &addresses)
+	err = p.private("returnDepositAddresses", nil, &addresses)
 	return
 }
 
@@ -236,18 +238,34 @@ func (p *Poloniex) GenerateNewAddress(currency string) (address string, err erro
 	return
 }
 
+// DepositsWithdrawals returns the deposits and withdrawals of about the last 217 days
 func (p *Poloniex) DepositsWithdrawals() (depositsWithdrawals DepositsWithdrawals, err error) {
+	return p.DepositsWithdrawalsRange(time.Now().Add(-5208*time.Hour), time.Unix(9999999999, 0))
+}
+
+// DepositsWithdrawalsRange returns the deposits and withdrawals between start and end
+func (p *Poloniex) DepositsWithdrawalsRange(start, end time.Time) (depositsWithdrawals DepositsWithdrawals, err error) {
+	return p.depositsWithdrawalsRange(context.Background(), start, end)
+}
+
+// depositsWithdrawalsRange is DepositsWithdrawalsRange as part of the span in ctx
+func (p *Poloniex) depositsWithdrawalsRange(ctx context.Context, start, end time.Time) (depositsWithdrawals DepositsWithdrawals, err error) {
 	params := url.Values{}
-	params.Add("start", fmt.Sprintf("%d", time.Now().Add(-5208*time.Hour).Unix()))
-	params.Add("end", "9999999999")
-	err = p.private("returnDepositsWithdrawals", params, &depositsWithdrawals)
+	params.Add("start", fmt.Sprintf("%d", start.Unix()))
+	params.Add("end", fmt.Sprintf("%d", end.Unix()))
+	err = p.privateContext(ctx, "returnDepositsWithdrawals", params, &depositsWithdrawals)
 	return
 }
 
 func (p *Poloniex) OpenOrders(pair string) (openOrders OpenOrders, err error) {
+	return p.OpenOrdersContext(context.Background(), pair)
+}
+
+// OpenOrdersContext is OpenOrders with ctx like BuyContext
+func (p *Poloniex) OpenOrdersContext(ctx context.Context, pair string) (openOrders OpenOrders, err error) {
 	params := url.Values{}
 	params.Add("currencyPair", pair)
-	err = p.private("returnOpenOrders", params, &openOrders)
+	err = p.privateContext(ctx, "returnOpenOrders", params, &openOrders)
 	return
 }
 
@@ -273,81 +291,194 @@ func (p *Poloniex) PrivateTradeHistoryAll() (history PrivateTradeHistoryAll, err
 }
 
 func (p *Poloniex) OrderTrades(orderNumber int64) (ot OrderTrades, err error) {
+	return p.OrderTradesContext(context.Background(), orderNumber)
+}
+
+// OrderTradesContext is OrderTrades with ctx like BuyContext
+func (p *Poloniex) OrderTradesContext(ctx context.Context, orderNumber int64) (ot OrderTrades, err error) {
 	params := url.Values{}
 	params.Add("orderNumber", fmt.Sprintf("%d", orderNumber))
-	err = p.private("returnOrderTrades", params, &ot)
+	err = p.privateContext(ctx, "returnOrderTrades", params, &ot)
 	return
 }
 
 func (p *Poloniex) CancelOrder(orderNumber int64) (success bool, err error) {
+	return p.CancelOrderContext(context.Background(), orderNumber)
+}
+
+// CancelOrderContext is CancelOrder with ctx like BuyContext
+func (p *Poloniex) CancelOrderContext(ctx context.Context, orderNumber int64) (success bool, err error) {
 	params := url.Values{}
 	params.Add("orderNumber", fmt.Sprintf("%d", orderNumber))
 	b := Base{}
-	err = p.private("cancelOrder", params, &b)
+	err = p.privateContext(ctx, "cancelOrder", params, &b)
 	success = b.Success == 1
 	return
 }
 
 func (p *Poloniex) Buy(pair string, rate, amount ggm.Decimal) (buy Buy, err error) {
-	params := url.Values{}
-	params.Add("currencyPair", pair)
-	params.Add("rate", rate.String())
-	params.Add("amount", amount.String())
-	err = p.private("buy", params, &buy)
-	return
+	return p.BuyContext(context.Background(), pair, rate, amount)
+}
+
+// BuyContext is Buy traced as part of the span in ctx. If ctx is done before the order is sent, while it
+// waits for the rate limiter or for other calls of the client, it isn't sent and ctx.Err() is returned;
+// an order already sent waits for its answer.
+func (p *Poloniex) BuyContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (buy Buy, err error) {
+	return p.placeOrder(ctx, "buy", pair, rate, amount, nil)
 }
 
 func (p *Poloniex) BuyPostOnly(pair string, rate, amount ggm.Decimal) (buy Buy, err error) {
-	params := url.Values{}
-	params.Add("currencyPair", pair)
-	params.Add("rate", rate.String())
-	params.Add("amount", amount.String())
-	params.Add("postOnly", "1")
-	err = p.private("buy", params, &buy)
-	return
+	return p.BuyPostOnlyContext(context.Background(), pair, rate, amount)
+}
+
+// BuyPostOnlyContext is BuyPostOnly with ctx like BuyContext
+func (p *Poloniex) BuyPostOnlyContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (buy Buy, err error) {
+	return p.placeOrder(ctx, "buy", pair, rate, amount, url.Values{"postOnly": {"1"}})
 }
 
 func (p *Poloniex) Sell(pair string, rate, amount ggm.Decimal) (sell Sell, err error) {
-	params := url.Values{}
-	params.Add("currencyPair", pair)
-	params.Add("rate", rate.String())
-	params.Add("amount", amount.String())
-	err = p.private("sell", params, &sell)
+	return p.SellContext(context.Background(), pair, rate, amount)
+}
+
+// SellContext is Sell with ctx like BuyContext
+func (p *Poloniex) SellContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (sell Sell, err error) {
+	sell.Buy, err = p.placeOrder(ctx, "sell", pair, rate, amount, nil)
 	return
 }
 
 func (p *Poloniex) SellPostOnly(pair string, rate, amount ggm.Decimal) (sell Sell, err error) {
-	params := url.Values{}
+	return p.SellPostOnlyContext(context.Background(), pair, rate, amount)
+}
+
+// SellPostOnlyContext is SellPostOnly with ctx like BuyContext
+func (p *Poloniex) SellPostOnlyContext(ctx context.Context, pair string, rate, amount ggm.Decimal) (sell Sell, err error) {
+	sell.Buy, err = p.placeOrder(ctx, "sell", pair, rate, amount, url.Values{"postOnly": {"1"}})
+	return
+}
+
+// placeOrder places a limit order of command "buy" or "sell" with the extra parameters in params,
+// checked by the validator of the client if there is one
+func (p *Poloniex) placeOrder(ctx context.Context, command, pair string, rate, amount ggm.Decimal, params url.Values) (order Buy, err error) {
+	err = p.place(ctx, command, pair, rate, amount, params, &order, &order)
+	return
+}
+
+// place is placeOrder decoding the result into v, order is the Buy in v
+func (p *Poloniex) place(ctx context.Context, command, pair string, rate, amount ggm.Decimal, params url.Values, v interface{}, order *Buy) (err error) {
+	if p.validator != nil {
+		if rate, amount, err = p.validator.Order(command, pair, rate, amount); err != nil {
+			return
+		}
+	}
+	if params == nil {
+		params = url.Values{}
+	}
 	params.Add("currencyPair", pair)
 	params.Add("rate", rate.String())
 	params.Add("amount", amount.String())
-	params.Add("postOnly", "1")
-	err = p.private("sell", params, &sell)
+	err = p.privateContext(ctx, command, params, v)
+	if err == nil && p.validator != nil {
+		p.validator.placed(order.OrderNumber, pair)
+	}
 	return
 }
 
 func (p *Poloniex) Move(orderNumber int64, rate ggm.Decimal) (moveOrder MoveOrder, err error) {
-	params := url.Values{}
-	params.Add("orderNumber", fmt.Sprintf("%d", orderNumber))
-	params.Add("rate", rate.String())
-	err = p.private("moveOrder", params, &moveOrder)
-	return
+	return p.MoveContext(context.Background(), orderNumber, rate)
 }
 
+// MoveContext is Move with ctx like BuyContext
+func (p *Poloniex) MoveContext(ctx context.Context, orderNumber int64, rate ggm.Decimal) (moveOrder MoveOrder, err error) {
+	return p.moveOrder(ctx, orderNumber, rate, nil)
+}
+
+// MovePostOnly moves an order to rate only if it doesn't take liquidity there, it fails with ErrorRejected otherwise
 func (p *Poloniex) MovePostOnly(orderNumber int64, rate ggm.Decimal) (moveOrder MoveOrder, err error) {
-	params := url.Values{}
+	return p.MovePostOnlyContext(context.Background(), orderNumber, rate)
+}
+
+// MovePostOnlyContext is MovePostOnly with ctx like BuyContext
+func (p *Poloniex) MovePostOnlyContext(ctx context.Context, orderNumber int64, rate ggm.Decimal) (moveOrder MoveOrder, err error) {
+	return p.moveOrder(ctx, orderNumber, rate, url.Values{"postOnly": {"1"}})
+}
+
+// moveOrder moves an order with the extra parameters in params, checked by the validator of the client
+// if there is one
+func (p *Poloniex) moveOrder(ctx context.Context, orderNumber int64, rate ggm.Decimal, params url.Values) (moveOrder MoveOrder, err error) {
+	if rate, err = p.validMove(orderNumber, rate); err != nil {
+		return
+	}
+	if params == nil {
+		params = url.Values{}
+	}
 	params.Add("orderNumber", fmt.Sprintf("%d", orderNumber))
 	params.Add("rate", rate.String())
-	err = p.private("moveOrder", params, &moveOrder)
+	err = p.privateContext(ctx, "moveOrder", params, &moveOrder)
+	if err == nil && p.validator != nil && moveOrder.Success == 1 {
+		p.validator.moved(orderNumber, moveOrder.OrderNumber)
+	}
 	return
 }
 
+// validMove checks moving an order with the validator of the client if there is one
+func (p *Poloniex) validMove(orderNumber int64, rate ggm.Decimal) (ggm.Decimal, error) {
+	if p.validator == nil {
+		return rate, nil
+	}
+	return p.validator.Move(orderNumber, rate)
+}
+
 func (p *Poloniex) Withdraw(currency string, amount ggm.Decimal, address string) (w Withdraw, err error) {
+	return p.WithdrawPaymentIDContext(context.Background(), currency, amount, address, "")
+}
+
+// WithdrawContext is Withdraw with ctx like BuyContext
+func (p *Poloniex) WithdrawContext(ctx context.Context, currency string, amount ggm.Decimal, address string) (w Withdraw, err error) {
+	return p.WithdrawPaymentIDContext(ctx, currency, amount, address, "")
+}
+
+// WithdrawPaymentID is Withdraw with the payment ID some currencies need besides the address, none if empty.
+// The withdrawal guard of the client, if there is one, checks it before it is sent. Poloniex answers with
+// a message only, WithdrawalNumber is looked up in the history afterwards. It is 0 with LookupError set
+// when the lookup fails or finds no single match, the withdrawal went through all the same.
+func (p *Poloniex) WithdrawPaymentID(currency string, amount ggm.Decimal, address, paymentID string) (w Withdraw, err error) {
+	return p.WithdrawPaymentIDContext(context.Background(), currency, amount, address, paymentID)
+}
+
+// WithdrawPaymentIDContext is WithdrawPaymentID with ctx like BuyContext
+func (p *Poloniex) WithdrawPaymentIDContext(ctx context.Context, currency string, amount ggm.Decimal, address, paymentID string) (w Withdraw, err error) {
+	var sent *guardedWithdrawal
+	if p.guard != nil {
+		if sent, err = p.guard.check(currency, amount, address, paymentID); err != nil {
+			return
+		}
+	}
 	params := url.Values{}
 	params.Add("currency", currency)
 	params.Add("amount", amount.String())
 	params.Add("address", address)
-	err = p.private("withdraw", params, w)
+	if paymentID != "" {
+		params.Add("paymentId", paymentID)
+	}
+	start := time.Now()
+	raw := json.RawMessage{}
+	err = p.privateContext(ctx, "withdraw", params, &raw)
+	if err != nil {
+		if sent != nil && !errors.As(err, new(*sentError)) {
+			// refused by the exchange or given up before it was sent, it doesn't count towards the daily
+			// limit, unlike a call that may have gone through
+			p.guard.failed(sent)
+		}
+		return
+	}
+	if err = decodePrivate(string(raw), &w); err != nil {
+		return
+	}
+	if w.WithdrawalNumber == 0 {
+		if w.WithdrawalNumber, w.LookupError = p.withdrawalNumber(ctx, currency, amount, address, start); w.LookupError != nil {
+			p.log().Warn("withdrawal number unknown", "currency", currency, "address", address, "error", w.LookupError)
+		}
+	}
 	return
 }
 
@@ -389,7 +520,6 @@ func (p *Poloniex) TransferBalance(currency string, amount ggm.Decimal, from str
 	params.Add("amount", amount.String())
 	params.Add("fromAccount", from)
 	params.Add("toAccount", to)
-	fmt.Printf("%+v", params)
 	err = p.private("transferBalance", params, &tb)
 	return
 }
@@ -456,10 +586,25 @@ func (p *Poloniex) ToggleAutoRenew(orderNumber int64) (success bool, err error)
 
 // make a call to the jsonrpc api, marshal into v
 func (p *Poloniex) private(method string, params url.Values, retval interface{}) error {
-	if p.debug {
-		defer un(trace("private: " + method))
+	return p.privateContext(context.Background(), method, params, retval)
+}
+
+func (p *Poloniex) privateContext(ctx context.Context, method string, params url.Values, retval interface{}) error {
+	if pt := p.paperTrading(); pt != nil && pt.serves(method) {
+		// answered by the simulated account at the end of the middleware chain, nothing is signed or sent
+		if params == nil {
+			params = url.Values{}
+		}
+		s, err := p.do(context.WithValue(ctx, paperKey{}, pt), "private", method, params)
+		if err != nil {
+			return err
+		}
+		return decodePrivate(s, retval)
 	}
 
+	if err := p.waitRateLimit(ctx); err != nil {
+		return err
+	}
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 	if params == nil {
@@ -467,56 +612,28 @@ func (p *Poloniex) private(method string, params url.Values, retval interface{})
 	}
 	params.Set("nonce", p.GetNonce())
 	params.Set("command", method)
-	postData := params.Encode()
 
-	req := goreq.Request{
-		Method:      "POST",
-		Uri:         PRIVATEURI,
-		Body:        postData,
-		ContentType: "application/x-www-form-urlencoded",
-		Accept:      "application/json",
-		Timeout:     130 * time.Second,
-	}
-
-	req.AddHeader("Sign", p.sign(postData))
-	req.AddHeader("Key", p.Key)
-	req.AddHeader("Content-Length", strconv.Itoa(len(postData)))
-
-	res, err := req.Do()
-	if err != nil {
-		return err
-	}
-
-	defer res.Body.Close()
-
-	s, err := res.Body.ToString()
+	s, err := p.do(ctx, "private", method, params)
 	if err != nil {
 		return err
 	}
 
-	if p.debug {
-		fmt.Println(s)
-	}
+	return decodePrivate(s, retval)
+}
 
-	// TODO: fix this shit, it's really crappy.
-	if strings.HasPrefix(s, "[") {
-		// poloniex only ever returns an array type when there is no real data
-		// e.g. no data in a time range
-		// if this ever changes then this breaks
+func decodePrivate(s string, retval interface{}) error {
+	// poloniex returns an empty array instead of an empty object when there is no data,
+	// e.g. no data in a time range, which can't be decoded into a map or struct
+	if strings.TrimSpace(s) == "[]" {
 		return nil
 	}
 
-	err = json.Unmarshal([]byte(s), retval)
-	if err != nil && retval == nil {
-		log.Println(err)
-		return err
-	}
-	return err
+	return json.Unmarshal([]byte(s), retval)
 }
 
 // generate hmac-sha512 hash, hex encoded
-func (p *Poloniex) sign(payload string) string {
-	mac := hmac.New(sha512.New, []byte(p.Secret))
+func sign(secret, payload string) string {
+	mac := hmac.New(sha512.New, []byte(secret))
 	mac.Write([]byte(payload))
 	return hex.EncodeToString(mac.Sum(nil))
 }
@@ -1,16 +1,13 @@
 package poloniex
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"time"
 
-	"log"
-
-	"github.com/franela/goreq"
 	"github.com/hhh0pE/ggm"
-	"github.com/k0kubun/pp"
 )
 
 type (
@@ -73,6 +70,7 @@ type (
 
 	Currencies map[string]Currency
 	Currency   struct {
+		ID             int64 `json:"id"`
 		Name           string
 		TxFee          ggm.Decimal `json:",string"`
 		MinConf        ggm.Decimal
@@ -114,7 +112,7 @@ func (p *Poloniex) DailyVolume() (dailyVolume DailyVolume, err error) {
 			v := i.(map[string]interface{})
 			for kk, vv := range v {
 				if parsed, err := ggm.ParseDecimal(vv); err != nil {
-					log.Println("Error when parsing \"", vv, "\": "+err.Error())
+					p.log().Warn("parsing daily volume failed", "market", k, "currency", kk, "value", vv, "error", err)
 					dve[kk] = parsed
 				} else {
 					dve[kk] = parsed
@@ -129,15 +127,20 @@ func (p *Poloniex) DailyVolume() (dailyVolume DailyVolume, err error) {
 }
 
 func (p *Poloniex) OrderBook(pair string) (orderBook OrderBook, err error) {
+	return p.orderBook(context.Background(), pair)
+}
+
+// orderBook is OrderBook as part of the span in ctx
+func (p *Poloniex) orderBook(ctx context.Context, pair string) (orderBook OrderBook, err error) {
 	params := url.Values{}
 	params.Add("currencyPair", pair)
 	params.Add("depth", "40")
 	obt := OrderBookTemp{}
-	err = p.public("returnOrderBook", params, &obt)
+	err = p.publicContext(ctx, "returnOrderBook", params, &obt)
 	if err != nil {
 		return
 	}
-	orderBook = tempToOrderBook(obt)
+	orderBook = p.tempToOrderBook(obt)
 	return
 }
 
@@ -152,13 +155,12 @@ func (p *Poloniex) OrderBookAll() (orderBook OrderBookAll, err error) {
 	}
 	orderBook = OrderBookAll{}
 	for k, v := range obt {
-		orderBook[k] = tempToOrderBook(v)
+		orderBook[k] = p.tempToOrderBook(v)
 	}
 	return
 }
 
 func (p *Poloniex) TradeHistory(in ...interface{}) (tradeHistory TradeHistory, err error) {
-	pp.Println(in)
 	params := url.Values{}
 	params.Add("currencyPair", in[0].(string))
 	if len(in) > 1 {
@@ -215,23 +217,30 @@ func (p *Poloniex) LoanOrders(currency string) (loanOrders LoanOrders, err error
 	return
 }
 
-func tempToOrderBook(obt OrderBookTemp) (ob OrderBook) {
+func (p *Poloniex) tempToOrderBook(obt OrderBookTemp) (ob OrderBook) {
 	asks := obt.Asks
 	bids := obt.Bids
-	ob.IsFrozen = obt.IsFrozen.(string) != "0"
+	switch frozen := obt.IsFrozen.(type) {
+	case string:
+		ob.IsFrozen = frozen != "0" && frozen != ""
+	case float64:
+		ob.IsFrozen = frozen != 0
+	case bool:
+		ob.IsFrozen = frozen
+	}
 	ob.Asks = []Order{}
 	ob.Bids = []Order{}
 	for k := range asks {
 		v := asks[k]
 		var o Order
 		if parsed, err := ggm.ParseDecimal(v[0]); err != nil {
-			log.Println("tempToOrderBook error when parsing ask's Rate: " + err.Error())
+			p.log().Warn("parsing order book failed", "side", "ask", "field", "Rate", "error", err)
 		} else {
 			o.Rate = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(v[1]); err != nil {
-			log.Println("tempToOrderBook error when parsing ask's Amount: " + err.Error())
+			p.log().Warn("parsing order book failed", "side", "ask", "field", "Amount", "error", err)
 		} else {
 			o.Amount = parsed
 		}
@@ -242,13 +251,13 @@ func tempToOrderBook(obt OrderBookTemp) (ob OrderBook) {
 		var o Order
 
 		if parsed, err := ggm.ParseDecimal(v[0]); err != nil {
-			log.Println("tempToOrderBook error when parsing bid's Rate: " + err.Error())
+			p.log().Warn("parsing order book failed", "side", "bid", "field", "Rate", "error", err)
 		} else {
 			o.Rate = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(v[1]); err != nil {
-			log.Println("tempToOrderBook error when parsing bid's Amount: " + err.Error())
+			p.log().Warn("parsing order book failed", "side", "bid", "field", "Amount", "error", err)
 		} else {
 			o.Amount = parsed
 		}
@@ -273,8 +282,12 @@ func tempToOrderBook(obt OrderBookTemp) (ob OrderBook) {
 //}
 
 func (p *Poloniex) public(command string, params url.Values, retval interface{}) (err error) {
-	if p.debug {
-		defer un(trace("public: " + command))
+	return p.publicContext(context.Background(), command, params, retval)
+}
+
+func (p *Poloniex) publicContext(ctx context.Context, command string, params url.Values, retval interface{}) (err error) {
+	if err = p.waitRateLimit(ctx); err != nil {
+		return
 	}
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -282,24 +295,10 @@ func (p *Poloniex) public(command string, params url.Values, retval interface{})
 		params = url.Values{}
 	}
 	params.Add("command", command)
-	req := goreq.Request{Uri: PUBLICURI, QueryString: params, Timeout: 130 * time.Second}
-	res, err := req.Do()
+	s, err := p.do(ctx, "public", command, params)
 	if err != nil {
 		return
 	}
-	if p.debug {
-		pp.Println(res.Request.URL.String())
-	}
-
-	defer res.Body.Close()
-
-	s, err := res.Body.ToString()
-	if err != nil {
-		return
-	}
-	if p.debug {
-		pp.Println(s)
-	}
 	err = json.Unmarshal([]byte(s), retval)
 	return
 }
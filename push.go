@@ -0,0 +1,540 @@
+package poloniex
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+	"gopkg.in/beatgammit/turnpike.v2"
+)
+
+type (
+	//WSBalanceUpdate describes a change of the balance of a currency in one of the wallets
+	WSBalanceUpdate struct {
+		CurrencyID int64
+		Wallet     string
+		Amount     ggm.Decimal
+	}
+
+	//WSNewOrder describes a limit order placed on the account
+	WSNewOrder struct {
+		PairID         int64
+		OrderNumber    int64
+		Type           string
+		Rate           ggm.Decimal
+		Amount         ggm.Decimal
+		OriginalAmount ggm.Decimal
+		Date           string
+		TS             time.Time
+	}
+
+	//WSOrderUpdate describes a change of the remaining amount of an open order
+	WSOrderUpdate struct {
+		OrderNumber int64
+		Amount      ggm.Decimal
+		Reason      string
+	}
+
+	//WSOwnTrade describes a trade that filled one of the account's orders
+	WSOwnTrade struct {
+		TradeID       int64
+		Rate          ggm.Decimal
+		Amount        ggm.Decimal
+		FeeMultiplier ggm.Decimal
+		FundingType   int64
+		OrderNumber   int64
+		Fee           ggm.Decimal
+		Date          string
+		TS            time.Time
+	}
+
+	//WSAccountEvent is a single account notification, exactly one of the pointers is set according to Type
+	WSAccountEvent struct {
+		Type        string
+		Balance     *WSBalanceUpdate
+		NewOrder    *WSNewOrder
+		OrderUpdate *WSOrderUpdate
+		Trade       *WSOwnTrade
+	}
+
+	//WSAccountNotification is a batch of account notifications sent in one message
+	WSAccountNotification struct {
+		Events []WSAccountEvent
+	}
+
+	//WSAccountChan is a conduit through which WSAccountNotification items are sent
+	WSAccountChan chan WSAccountNotification
+
+	//AccountSubscription delivers account notifications over C until closed
+	AccountSubscription struct {
+		*Subscription
+		C WSAccountChan
+	}
+
+	//DailyVolumeChan is a conduit through which DailyVolume snapshots are sent
+	DailyVolumeChan chan DailyVolume
+
+	//DailyVolumeSubscription delivers 24 hour volume snapshots over C until closed. The push channel only
+	//carries the volume per base currency, so a snapshot has just the DailyVolumeTotal entry.
+	DailyVolumeSubscription struct {
+		*Subscription
+		C DailyVolumeChan
+	}
+
+	pushSubscription struct {
+		signed  bool
+		handler func([]interface{})
+	}
+)
+
+const (
+	// PUSHURI is the address of the push websocket API on Poloniex
+	PUSHURI = "wss://api2.poloniex.com"
+
+	//AccountNotificationsChannel is the push channel carrying the account's own orders, trades and balances
+	AccountNotificationsChannel = 1000
+	//DailyVolumeChannel is the push channel carrying the 24 hour exchange volume
+	DailyVolumeChannel = 1003
+	//HeartbeatChannel is the push channel the server sends on when nothing else was sent for a second
+	HeartbeatChannel = 1010
+
+	//DailyVolumeTotal is the entry of a pushed DailyVolume holding the volume per base currency
+	DailyVolumeTotal = "total"
+
+	// defaultHeartbeatTimeout is the timeout of MonitorHeartbeat when none is given
+	defaultHeartbeatTimeout = 5 * time.Second
+)
+
+// NewAccountSubscription subscribes to the account notifications channel, signed with Key and Secret,
+// notifications are sent over its C
+func (p *Poloniex) NewAccountSubscription() (*AccountSubscription, error) {
+	ch := make(WSAccountChan)
+	s := p.newSubscription(pushTopic(AccountNotificationsChannel), func(v interface{}, done chan struct{}) {
+		select {
+		case ch <- v.(WSAccountNotification):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	t, err := p.pushChannel(AccountNotificationsChannel, true, p.handleAccountNotification)
+	if err != nil {
+		s.discard()
+		return nil, err
+	}
+	if err := p.addSubscription(s, t); err != nil {
+		s.discard()
+		return nil, err
+	}
+	return &AccountSubscription{Subscription: s, C: ch}, nil
+}
+
+// NewDailyVolumeSubscription subscribes to the 24 hour exchange volume channel, snapshots are sent over its C
+func (p *Poloniex) NewDailyVolumeSubscription() (*DailyVolumeSubscription, error) {
+	ch := make(DailyVolumeChan)
+	s := p.newSubscription(pushTopic(DailyVolumeChannel), func(v interface{}, done chan struct{}) {
+		select {
+		case ch <- v.(DailyVolume):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	t, err := p.pushChannel(DailyVolumeChannel, false, p.handleDailyVolume)
+	if err != nil {
+		s.discard()
+		return nil, err
+	}
+	if err := p.addSubscription(s, t); err != nil {
+		s.discard()
+		return nil, err
+	}
+	return &DailyVolumeSubscription{Subscription: s, C: ch}, nil
+}
+
+// LastMessageAge is the time since anything, heartbeats included, was received on the push websocket,
+// ok is false while nothing was received yet
+func (p *Poloniex) LastMessageAge() (age time.Duration, ok bool) {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.lastPush.IsZero() {
+		return 0, false
+	}
+	return time.Since(p.lastPush), true
+}
+
+// MonitorHeartbeat watches both websocket connections until Close. The push websocket is reconnected
+// and its channels subscribed again whenever nothing was received on it for longer than timeout, the
+// server sends a heartbeat every second when idle. The WAMP websocket, which has no heartbeat, is
+// reconnected and its topics subscribed again when the connection drops. A timeout of zero or less
+// means 5 seconds.
+func (p *Poloniex) MonitorHeartbeat(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultHeartbeatTimeout
+	}
+	interval := timeout / 2
+	if interval <= 0 {
+		interval = timeout
+	}
+	p.wsMutex.Lock()
+	if p.heartbeat != nil {
+		p.wsMutex.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	p.heartbeat = stop
+	p.wsMutex.Unlock()
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		var dropped *turnpike.Client
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+			if age, stale := p.pushStale(timeout); stale {
+				p.log().Warn("no push message, reconnecting", "uri", p.pushURI(), "age", age)
+				if err := p.reconnectPush(); err != nil {
+					p.log().Error("reconnecting push failed", "uri", p.pushURI(), "error", err)
+				}
+			}
+
+			p.wsMutex.Lock()
+			ws := p.ws
+			p.wsMutex.Unlock()
+			if dropped == nil && ws != nil {
+				select {
+				case <-ws.ReceiveDone:
+					dropped = ws
+					p.log().Warn("websocket connection dropped, reconnecting", "uri", p.wsURI())
+				default:
+				}
+			}
+			if dropped != nil {
+				ok, err := p.reconnectWAMP(dropped)
+				if err != nil {
+					p.log().Error("reconnecting websocket failed", "uri", p.wsURI(), "error", err)
+				}
+				if ok {
+					dropped = nil
+				}
+			}
+		}
+	}()
+}
+
+// pushStale reports whether nothing was received on an open push websocket for longer than timeout
+func (p *Poloniex) pushStale(timeout time.Duration) (time.Duration, bool) {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.push == nil {
+		return 0, false
+	}
+	last := p.pushSince
+	if p.lastPush.After(last) {
+		last = p.lastPush
+	}
+	age := time.Since(last)
+	return age, age > timeout
+}
+
+// reconnectPush replaces the push websocket connection and subscribes its channels again, the old
+// connection is kept until a new one is open
+func (p *Poloniex) reconnectPush() error {
+	p.wsMutex.Lock()
+	old := p.push
+	p.wsMutex.Unlock()
+	if old == nil {
+		return nil
+	}
+	c, _, err := websocket.DefaultDialer.Dial(p.pushURI(), nil)
+	if err != nil {
+		return errors.Wrap(err, "reconnect of websocket connection to "+p.pushURI()+" failed")
+	}
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.push != old {
+		// closed or replaced meanwhile
+		c.Close()
+		return nil
+	}
+	old.Close()
+	p.push = c
+	p.pushSince = time.Now()
+	go p.readPush(c)
+	for channel, ps := range p.pushHandlers {
+		if err := p.pushCommand("subscribe", channel, ps.signed); err != nil {
+			return errors.Wrap(err, "resubscribing to channel "+strconv.Itoa(channel)+" failed")
+		}
+	}
+	p.measure().ObserveReconnect("push")
+	return nil
+}
+
+// reconnectWAMP replaces the dropped WAMP websocket connection and subscribes its topics again, done is
+// false when it should be tried again
+func (p *Poloniex) reconnectWAMP(dropped *turnpike.Client) (done bool, err error) {
+	p.wsMutex.Lock()
+	current := p.ws == dropped
+	p.wsMutex.Unlock()
+	if !current {
+		return true, nil
+	}
+	c, err := p.dialWS()
+	if err != nil {
+		return false, err
+	}
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.ws != dropped {
+		// closed or replaced meanwhile
+		c.Close()
+		return true, nil
+	}
+	dropped.Close()
+	p.ws = c
+	for topic, t := range p.topics {
+		if t.feed != "wamp" {
+			continue
+		}
+		if err := t.subscribe(); err != nil {
+			return true, errors.Wrap(err, "resubscribing to "+topic+" failed")
+		}
+	}
+	p.measure().ObserveReconnect("wamp")
+	return true, nil
+}
+
+func pushTopic(channel int) string {
+	return "push:" + strconv.Itoa(channel)
+}
+
+// initPush opens the push websocket connection if it isn't open yet
+func (p *Poloniex) initPush() error {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.pushHandlers == nil {
+		p.pushHandlers = map[int]*pushSubscription{}
+	}
+	if p.push != nil || p.cassetteMode == cassetteReplay {
+		return nil
+	}
+	c, _, err := websocket.DefaultDialer.Dial(p.pushURI(), nil)
+	if err != nil {
+		return errors.Wrap(err, "open of websocket connection to "+p.pushURI()+" failed")
+	}
+	p.push = c
+	p.pushSince = time.Now()
+	go p.readPush(c)
+	return nil
+}
+
+// pushChannel describes how to subscribe to and unsubscribe from a channel of the push websocket
+func (p *Poloniex) pushChannel(channel int, signed bool, handler func([]interface{})) (*wsTopic, error) {
+	if err := p.initPush(); err != nil {
+		return nil, err
+	}
+	return &wsTopic{
+		feed: "push",
+		subscribe: func() error {
+			p.pushHandlers[channel] = &pushSubscription{signed: signed, handler: handler}
+			if p.cassetteMode == cassetteReplay {
+				return nil
+			}
+			return p.pushCommand("subscribe", channel, signed)
+		},
+		unsubscribe: func() error {
+			delete(p.pushHandlers, channel)
+			if p.cassetteMode == cassetteReplay || p.push == nil {
+				return nil
+			}
+			return p.pushCommand("unsubscribe", channel, false)
+		},
+	}, nil
+}
+
+// pushCommand sends a command for channel over the push websocket, signing it like a private call if asked to,
+// it must be called with wsMutex held
+func (p *Poloniex) pushCommand(command string, channel int, signed bool) error {
+	if p.push == nil {
+		return errors.New("push websocket closed")
+	}
+	m := map[string]interface{}{"command": command, "channel": channel}
+	if signed {
+		p.mutex.Lock()
+		payload := "nonce=" + p.GetNonce()
+		key, secret := p.keys()
+		m["key"] = key
+		m["payload"] = payload
+		m["sign"] = sign(secret, payload)
+		p.mutex.Unlock()
+	}
+	return p.push.WriteJSON(m)
+}
+
+// readPush dispatches the messages of the push websocket to the handler of their channel
+func (p *Poloniex) readPush(c *websocket.Conn) {
+	for {
+		_, b, err := c.ReadMessage()
+		if err != nil {
+			p.wsMutex.Lock()
+			current := p.push == c
+			p.wsMutex.Unlock()
+			if current {
+				p.log().Error("reading push failed", "uri", p.pushURI(), "error", err)
+			}
+			return
+		}
+		p.wsMutex.Lock()
+		p.lastPush = time.Now()
+		p.wsMutex.Unlock()
+		if p.cassetteMode == cassetteRecord {
+			p.cassette.recordFrame(Frame{Push: append(json.RawMessage{}, b...)})
+		}
+		msg := []interface{}{}
+		if err := json.Unmarshal(b, &msg); err != nil {
+			p.log().Warn("ws push parse error", "error", err)
+			continue
+		}
+		p.dispatchPush(msg)
+	}
+}
+
+// dispatchPush hands a push message to the handler of its channel
+func (p *Poloniex) dispatchPush(msg []interface{}) {
+	if len(msg) == 0 {
+		return
+	}
+	channel, ok := msg[0].(float64)
+	if !ok {
+		return
+	}
+	p.wsMutex.Lock()
+	ps := p.pushHandlers[int(channel)]
+	p.wsMutex.Unlock()
+	if ps != nil {
+		ps.handler(msg)
+	}
+}
+
+// handleAccountNotification parses a message of the account notifications channel, e.g.
+// [1000,"",[["b",28,"e","-0.06000000"],["o",12345,"0.00000000","f"]]]
+func (p *Poloniex) handleAccountNotification(msg []interface{}) {
+	if len(msg) < 3 {
+		// subscription acknowledgement, e.g. [1000,1]
+		return
+	}
+	items, ok := msg[2].([]interface{})
+	if !ok {
+		return
+	}
+	n := WSAccountNotification{}
+	for _, i := range items {
+		v, ok := i.([]interface{})
+		if !ok || len(v) == 0 {
+			continue
+		}
+		e := WSAccountEvent{}
+		e.Type, _ = v[0].(string)
+		switch e.Type {
+		case "b":
+			if len(v) < 4 {
+				continue
+			}
+			b := WSBalanceUpdate{CurrencyID: pushInt(v[1]), Wallet: pushString(v[2])}
+			b.Amount = p.pushDecimal(v[3], "balance Amount")
+			e.Balance = &b
+		case "n":
+			if len(v) < 7 {
+				continue
+			}
+			o := WSNewOrder{PairID: pushInt(v[1]), OrderNumber: pushInt(v[2]), Date: pushString(v[6])}
+			o.Type = "sell"
+			if pushInt(v[3]) == 1 {
+				o.Type = "buy"
+			}
+			o.Rate = p.pushDecimal(v[4], "new order Rate")
+			o.Amount = p.pushDecimal(v[5], "new order Amount")
+			o.OriginalAmount = o.Amount
+			if len(v) > 7 {
+				o.OriginalAmount = p.pushDecimal(v[7], "new order OriginalAmount")
+			}
+			o.TS, _ = time.Parse("2006-01-02 15:04:05", o.Date)
+			e.NewOrder = &o
+		case "o":
+			if len(v) < 3 {
+				continue
+			}
+			u := WSOrderUpdate{OrderNumber: pushInt(v[1])}
+			u.Amount = p.pushDecimal(v[2], "order update Amount")
+			if len(v) > 3 {
+				u.Reason = pushString(v[3])
+			}
+			e.OrderUpdate = &u
+		case "t":
+			if len(v) < 7 {
+				continue
+			}
+			t := WSOwnTrade{TradeID: pushInt(v[1]), FundingType: pushInt(v[5]), OrderNumber: pushInt(v[6])}
+			t.Rate = p.pushDecimal(v[2], "trade Rate")
+			t.Amount = p.pushDecimal(v[3], "trade Amount")
+			t.FeeMultiplier = p.pushDecimal(v[4], "trade FeeMultiplier")
+			if len(v) > 7 {
+				t.Fee = p.pushDecimal(v[7], "trade Fee")
+			}
+			if len(v) > 8 {
+				t.Date = pushString(v[8])
+				t.TS, _ = time.Parse("2006-01-02 15:04:05", t.Date)
+			}
+			e.Trade = &t
+		default:
+			continue
+		}
+		n.Events = append(n.Events, e)
+	}
+	p.publish(pushTopic(AccountNotificationsChannel), n)
+}
+
+// handleDailyVolume parses a message of the 24 hour volume channel, e.g.
+// [1003,null,["2018-11-07 16:26",5804,{"BTC":"3418.409","ETH":"2510.760","USDT":"26112283.928"}]]
+func (p *Poloniex) handleDailyVolume(msg []interface{}) {
+	if len(msg) < 3 {
+		return
+	}
+	v, ok := msg[2].([]interface{})
+	if !ok || len(v) < 3 {
+		return
+	}
+	total := DailyVolumeEntry{}
+	totals, _ := v[2].(map[string]interface{})
+	for k, vv := range totals {
+		total[k] = p.pushDecimal(vv, "daily volume "+k)
+	}
+	dv := DailyVolume{DailyVolumeTotal: total}
+	p.publish(pushTopic(DailyVolumeChannel), dv)
+}
+
+func pushInt(v interface{}) int64 {
+	switch i := v.(type) {
+	case float64:
+		return int64(i)
+	case string:
+		n, _ := strconv.ParseInt(i, 10, 64)
+		return n
+	}
+	return 0
+}
+
+func pushString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func (p *Poloniex) pushDecimal(v interface{}, what string) ggm.Decimal {
+	parsed, err := ggm.ParseDecimal(v)
+	if err != nil {
+		p.log().Warn("ws push parse error", "field", what, "error", err)
+	}
+	return parsed
+}
@@ -0,0 +1,86 @@
+package poloniex
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	//RateLimiter spaces out REST calls, clients going out through the same IP should share one
+	RateLimiter struct {
+		mu       sync.Mutex
+		interval time.Duration
+		next     time.Time
+	}
+)
+
+// DefaultRateLimit is the number of REST calls per second Poloniex allows an IP
+const DefaultRateLimit = 6
+
+// NewRateLimiter returns a limiter letting perSecond calls through every second, any number if perSecond
+// isn't positive
+func NewRateLimiter(perSecond int) *RateLimiter {
+	if perSecond <= 0 {
+		return &RateLimiter{}
+	}
+	return &RateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+// Wait blocks until the next call may be made
+func (r *RateLimiter) Wait() {
+	r.WaitContext(context.Background())
+}
+
+// WaitContext is Wait giving up with ctx.Err() when ctx is done first, the call then doesn't use up its turn
+func (r *RateLimiter) WaitContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.interval <= 0 {
+		return nil
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	reserved := r.next
+	r.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.mu.Lock()
+		if r.next.Equal(reserved) {
+			// no later call took a turn, give this one back
+			r.next = r.next.Add(-r.interval)
+		}
+		r.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// UseRateLimiter makes every REST call of the client wait for r first
+func (p *Poloniex) UseRateLimiter(r *RateLimiter) {
+	p.limiter = r
+}
+
+// waitRateLimit waits for the limiter before a REST call is sent, it is called before taking p.mutex
+// so a throttled call holds up no other call. Replayed calls aren't sent and don't wait.
+func (p *Poloniex) waitRateLimit(ctx context.Context) error {
+	if p.limiter == nil || p.cassetteMode == cassetteReplay {
+		return ctx.Err()
+	}
+	waiting := time.Now()
+	err := p.limiter.WaitContext(ctx)
+	p.measure().ObserveRateLimitWait(time.Since(waiting))
+	return err
+}
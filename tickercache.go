@@ -0,0 +1,188 @@
+package poloniex
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	//TickerCache holds the latest ticker of every pair, seeded from Ticker(), kept fresh from the
+	//websocket ticker feed and polled over REST whenever the feed is down or silent. Once the client
+	//is closed the cache only polls.
+	TickerCache struct {
+		p       *Poloniex
+		poll    time.Duration
+		mu      sync.RWMutex
+		entries Ticker
+		updated map[string]time.Time
+		stop    chan struct{}
+		done    chan struct{}
+	}
+)
+
+// NewTickerCache seeds a cache from Ticker() and keeps it up to date in the background,
+// poll is how long the websocket feed may stay silent before the cache falls back to REST
+func (p *Poloniex) NewTickerCache(poll time.Duration) (*TickerCache, error) {
+	c := &TickerCache{
+		p:       p,
+		poll:    poll,
+		entries: Ticker{},
+		updated: map[string]time.Time{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	go c.run()
+	return c, nil
+}
+
+// Get returns the latest ticker of pair
+func (c *TickerCache) Get(pair string) (entry TickerEntry, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok = c.entries[pair]
+	return
+}
+
+// All returns a copy of the latest ticker of every pair
+func (c *TickerCache) All() Ticker {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t := Ticker{}
+	for k, v := range c.entries {
+		t[k] = v
+	}
+	return t
+}
+
+// UpdatedAt is when the ticker of pair was last updated, the zero time if it is unknown
+func (c *TickerCache) UpdatedAt(pair string) time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.updated[pair]
+}
+
+// Age is the time since the ticker of pair was last updated
+func (c *TickerCache) Age(pair string) time.Duration {
+	t := c.UpdatedAt(pair)
+	if t.IsZero() {
+		return 0
+	}
+	return time.Since(t)
+}
+
+// Close stops updating the cache, the latest values stay readable
+func (c *TickerCache) Close() error {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	<-c.done
+	return nil
+}
+
+func (c *TickerCache) refresh() error {
+	t, err := c.p.Ticker()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range t {
+		c.entries[k] = v
+		c.updated[k] = now
+	}
+	return nil
+}
+
+func (c *TickerCache) set(t WSTicker) {
+	e := TickerEntry{
+		Last:        t.Last,
+		Ask:         t.Ask,
+		Bid:         t.Bid,
+		Change:      t.PercentChange.DivideFloat(100),
+		BaseVolume:  t.BaseVolume,
+		QuoteVolume: t.QuoteVolume,
+	}
+	if t.IsFrozen {
+		e.IsFrozen = 1
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[t.Pair] = e
+	c.updated[t.Pair] = time.Now()
+}
+
+func (c *TickerCache) run() {
+	defer close(c.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	var sub *TickerSubscription
+	// subscribing happens in the background so polling goes on while the websocket is down
+	subscribed := make(chan *TickerSubscription, 1)
+	subscribing, closed := false, false
+	subscribe := func() {
+		subscribing = true
+		go func() {
+			s, err := c.p.newTickerSubscription(ctx)
+			if err != nil {
+				c.p.log().Warn("ticker cache subscription failed, polling", "error", err)
+			}
+			subscribed <- s
+		}()
+	}
+	defer func() {
+		cancel()
+		if subscribing {
+			sub = <-subscribed
+		}
+		if sub != nil {
+			sub.Close()
+		}
+	}()
+	subscribe()
+	timer := time.NewTimer(c.poll)
+	defer timer.Stop()
+	for {
+		var updates WSTickerChan
+		if sub != nil {
+			updates = sub.C
+		}
+		select {
+		case <-c.stop:
+			return
+		case s := <-subscribed:
+			subscribing = false
+			if s != nil {
+				sub = s
+			}
+		case t, ok := <-updates:
+			if !ok {
+				// the client was closed, keep polling without opening the websocket again
+				c.p.log().Info("ticker cache feed closed, polling")
+				sub, closed = nil, true
+				continue
+			}
+			c.set(t)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(c.poll)
+		case <-timer.C:
+			if err := c.refresh(); err != nil {
+				c.p.log().Warn("ticker cache refresh failed", "error", err)
+			}
+			if sub == nil && !subscribing && !closed {
+				subscribe()
+			}
+			timer.Reset(c.poll)
+		}
+	}
+}
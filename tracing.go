@@ -0,0 +1,43 @@
+package poloniex
+
+import "context"
+
+type (
+	//Tracer starts a span for every call of the client, attributes are alternating keys and values.
+	//poloniexotel.Tracer adapts an OpenTelemetry tracer.
+	Tracer interface {
+		Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span)
+	}
+
+	//Span is a call being traced, End is called with the error the call failed with, if any
+	Span interface {
+		SetAttributes(attrs ...interface{})
+		End(err error)
+	}
+
+	nopTracer struct{}
+	nopSpan   struct{}
+)
+
+func (nopTracer) Start(ctx context.Context, _ string, _ ...interface{}) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+func (nopSpan) SetAttributes(...interface{}) {}
+func (nopSpan) End(error)                    {}
+
+// SetTracer makes the client trace every REST call and websocket connect with t, nothing is traced by default.
+// Spans are children of the span in the context of the ...Context methods and of Connect, roots otherwise.
+func (p *Poloniex) SetTracer(t Tracer) {
+	if t == nil {
+		t = nopTracer{}
+	}
+	p.tracer = t
+}
+
+func (p *Poloniex) trace() Tracer {
+	if p.tracer == nil {
+		return nopTracer{}
+	}
+	return p.tracer
+}
@@ -0,0 +1,436 @@
+package poloniex
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+)
+
+type (
+	//OrderState is a stage in the life of a tracked order
+	OrderState string
+
+	//TrackedOrder is the state of an order followed by an OrderTracker. Amount, Filled and AvgPrice cover
+	//the whole order, fills made under the numbers it had before being moved included.
+	TrackedOrder struct {
+		OrderNumber int64
+		Pair        string
+		Type        string
+		Rate        ggm.Decimal
+		Amount      ggm.Decimal
+		Filled      ggm.Decimal
+		AvgPrice    ggm.Decimal
+		State       OrderState
+		// MovedFrom is the number the order had before it was moved, MovedTo the one it got when moved
+		MovedFrom int64
+		MovedTo   int64
+		Updated   time.Time
+	}
+
+	//OrderEvent is a change of a tracked order, either of its state or of its filled amount
+	OrderEvent struct {
+		Order    TrackedOrder
+		Previous OrderState
+	}
+
+	//OrderTracker follows placed orders through the account notifications of the push websocket and
+	//through periodic reconciliation with OpenOrders and OrderTrades, changes are sent over C until Stop
+	OrderTracker struct {
+		C chan OrderEvent
+
+		p      *Poloniex
+		mu     sync.Mutex
+		orders map[int64]*trackedOrder
+		// moving holds the orders being moved, true once the cancel of the move showed up
+		moving map[int64]bool
+		// early holds the fills of unknown orders while a move is pending, they may be of its new number
+		early    map[int64]map[int64]fill
+		pending  []OrderEvent
+		wake     chan struct{}
+		stop     chan struct{}
+		stopOnce sync.Once
+		sub      *AccountSubscription
+		wg       sync.WaitGroup
+	}
+
+	trackedOrder struct {
+		TrackedOrder
+		trades map[int64]fill
+		// reported is the filled amount of the last event
+		reported string
+	}
+
+	fill struct {
+		rate, amount *big.Rat
+	}
+)
+
+const (
+	// OrderOpen is an order resting in the book without fills
+	OrderOpen OrderState = "open"
+	// OrderPartiallyFilled is an order resting in the book with some of its amount filled
+	OrderPartiallyFilled OrderState = "partially_filled"
+	// OrderFilled is an order whose whole amount was filled
+	OrderFilled OrderState = "filled"
+	// OrderCancelled is an order removed from the book before it was filled
+	OrderCancelled OrderState = "cancelled"
+	// OrderMoved is an order replaced by a new one with another number, see MovedTo
+	OrderMoved OrderState = "moved"
+)
+
+// Final reports whether the order can't change anymore
+func (s OrderState) Final() bool {
+	return s == OrderFilled || s == OrderCancelled || s == OrderMoved
+}
+
+// NewOrderTracker returns a tracker following orders through the account notifications and reconciling
+// them with the exchange every reconcile, never when reconcile isn't positive. Without a push connection
+// the tracker only learns about orders by reconciliation.
+func (p *Poloniex) NewOrderTracker(reconcile time.Duration) *OrderTracker {
+	t := &OrderTracker{
+		C:      make(chan OrderEvent),
+		p:      p,
+		orders: map[int64]*trackedOrder{},
+		moving: map[int64]bool{},
+		early:  map[int64]map[int64]fill{},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	sub, err := p.NewAccountSubscription()
+	if err != nil {
+		p.log().Warn("order tracker without account notifications", "error", err)
+	} else {
+		t.sub = sub
+		t.wg.Add(1)
+		go t.notifications()
+	}
+	if reconcile > 0 {
+		t.wg.Add(1)
+		go t.reconcileEvery(reconcile)
+	}
+	t.wg.Add(1)
+	go t.deliver()
+	return t
+}
+
+// Stop ends the tracking and closes C
+func (t *OrderTracker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+		if t.sub != nil {
+			t.sub.Close()
+		}
+		t.wg.Wait()
+		close(t.C)
+	})
+}
+
+// Buy places a limit buy order and tracks it
+func (t *OrderTracker) Buy(pair string, rate, amount ggm.Decimal) (buy Buy, err error) {
+	buy, err = t.p.Buy(pair, rate, amount)
+	if err == nil {
+		t.Track(buy.OrderNumber, pair, "buy", rate, amount)
+	}
+	return
+}
+
+// Sell places a limit sell order and tracks it
+func (t *OrderTracker) Sell(pair string, rate, amount ggm.Decimal) (sell Sell, err error) {
+	sell, err = t.p.Sell(pair, rate, amount)
+	if err == nil {
+		t.Track(sell.OrderNumber, pair, "sell", rate, amount)
+	}
+	return
+}
+
+// Move moves a tracked order to rate, the order is marked moved and tracked further under its new number.
+// The cancel of the old number the exchange reports for the move isn't taken for a cancel of the order.
+func (t *OrderTracker) Move(orderNumber int64, rate ggm.Decimal) (moveOrder MoveOrder, err error) {
+	t.mu.Lock()
+	_, ok := t.orders[orderNumber]
+	if ok {
+		t.moving[orderNumber] = false
+	}
+	t.mu.Unlock()
+	if !ok {
+		return moveOrder, errors.Errorf("order %d isn't tracked", orderNumber)
+	}
+	moveOrder, err = t.p.Move(orderNumber, rate)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o := t.orders[orderNumber]
+	cancelled := t.moving[orderNumber]
+	delete(t.moving, orderNumber)
+	early := t.early[moveOrder.OrderNumber]
+	if len(t.moving) == 0 {
+		t.early = map[int64]map[int64]fill{}
+	}
+	if err == nil && moveOrder.Success != 1 {
+		err = errors.Errorf("moving order %d failed: %s", orderNumber, moveOrder.Error)
+	}
+	if err != nil {
+		if cancelled && !o.State.Final() {
+			// the order left the book on its own while the move was tried
+			t.setState(o, OrderCancelled)
+		}
+		return
+	}
+
+	moved := &trackedOrder{TrackedOrder: o.TrackedOrder, trades: map[int64]fill{}}
+	for id, f := range o.trades {
+		moved.trades[id] = f
+	}
+	for id, f := range early {
+		moved.trades[id] = f
+	}
+	moved.sum()
+	moved.OrderNumber = moveOrder.OrderNumber
+	moved.Rate = rate
+	moved.MovedFrom = orderNumber
+	moved.MovedTo = 0
+	moved.State, moved.reported = "", ""
+	t.orders[moved.OrderNumber] = moved
+	o.MovedTo = moved.OrderNumber
+	t.setState(o, OrderMoved)
+	t.setState(moved, moved.progress())
+	return
+}
+
+// Cancel cancels a tracked order
+func (t *OrderTracker) Cancel(orderNumber int64) (success bool, err error) {
+	success, err = t.p.CancelOrder(orderNumber)
+	if err != nil || !success {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if o, ok := t.orders[orderNumber]; ok && !o.State.Final() {
+		t.setState(o, OrderCancelled)
+	}
+	return
+}
+
+// Track follows an order placed elsewhere, typ is "buy" or "sell"
+func (t *OrderTracker) Track(orderNumber int64, pair, typ string, rate, amount ggm.Decimal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.orders[orderNumber]; ok {
+		return
+	}
+	o := &trackedOrder{
+		TrackedOrder: TrackedOrder{OrderNumber: orderNumber, Pair: pair, Type: typ, Rate: rate, Amount: amount},
+		trades:       map[int64]fill{},
+	}
+	o.Filled, o.AvgPrice = toDecimal(0), toDecimal(0)
+	t.orders[orderNumber] = o
+	t.setState(o, OrderOpen)
+}
+
+// Order returns the state of a tracked order
+func (t *OrderTracker) Order(orderNumber int64) (TrackedOrder, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, ok := t.orders[orderNumber]
+	if !ok {
+		return TrackedOrder{}, false
+	}
+	return o.TrackedOrder, true
+}
+
+// Orders returns the state of every tracked order by order number
+func (t *OrderTracker) Orders() []TrackedOrder {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	orders := make([]TrackedOrder, 0, len(t.orders))
+	for _, o := range t.orders {
+		orders = append(orders, o.TrackedOrder)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].OrderNumber < orders[j].OrderNumber })
+	return orders
+}
+
+// Reconcile brings the tracked orders that aren't final in line with OpenOrders and, for orders that
+// left the book or lost amount, OrderTrades. An order that left the book unfilled counts as cancelled.
+func (t *OrderTracker) Reconcile() error {
+	t.mu.Lock()
+	pairs := map[string][]TrackedOrder{}
+	for _, o := range t.orders {
+		if !o.State.Final() {
+			pairs[o.Pair] = append(pairs[o.Pair], o.TrackedOrder)
+		}
+	}
+	t.mu.Unlock()
+
+	for pair, orders := range pairs {
+		open, err := t.p.OpenOrders(pair)
+		if err != nil {
+			return errors.Wrap(err, "reconciling "+pair)
+		}
+		remaining := map[int64]*big.Rat{}
+		for _, o := range open {
+			remaining[o.OrderNumber] = toRat(o.Amount)
+		}
+		for _, o := range orders {
+			left, inBook := remaining[o.OrderNumber]
+			if inBook && left.Cmp(new(big.Rat).Sub(toRat(o.Amount), toRat(o.Filled))) >= 0 {
+				continue
+			}
+			trades, err := t.p.OrderTrades(o.OrderNumber)
+			if err != nil && !errors.Is(err, &APIError{Kind: ErrorUnknownOrder}) {
+				return errors.Wrapf(err, "reconciling order %d", o.OrderNumber)
+			}
+			t.mu.Lock()
+			to := t.orders[o.OrderNumber]
+			if _, moving := t.moving[o.OrderNumber]; moving {
+				// left the book for the move, Move takes it from here
+				t.mu.Unlock()
+				continue
+			}
+			for _, tr := range trades {
+				to.trades[tr.TradeID] = fill{rate: toRat(tr.Rate), amount: toRat(tr.Amount)}
+			}
+			to.sum()
+			if state := to.progress(); !to.State.Final() {
+				if !inBook && state != OrderFilled {
+					state = OrderCancelled
+				}
+				t.setState(to, state)
+			}
+			t.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func (t *OrderTracker) reconcileEvery(interval time.Duration) {
+	defer t.wg.Done()
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-tick.C:
+		}
+		if err := t.Reconcile(); err != nil {
+			t.p.log().Warn("reconciling tracked orders failed", "error", err)
+		}
+	}
+}
+
+// notifications applies the trades and order updates of the account notifications to the tracked orders
+func (t *OrderTracker) notifications() {
+	defer t.wg.Done()
+	for n := range t.sub.C {
+		t.mu.Lock()
+		for _, e := range n.Events {
+			switch {
+			case e.Trade != nil:
+				f := fill{rate: toRat(e.Trade.Rate), amount: toRat(e.Trade.Amount)}
+				o, ok := t.orders[e.Trade.OrderNumber]
+				if !ok {
+					if len(t.moving) > 0 {
+						// may be a fill of the new number of an order being moved, kept for Move
+						if t.early[e.Trade.OrderNumber] == nil {
+							t.early[e.Trade.OrderNumber] = map[int64]fill{}
+						}
+						t.early[e.Trade.OrderNumber][e.Trade.TradeID] = f
+					}
+					continue
+				}
+				o.trades[e.Trade.TradeID] = f
+				o.sum()
+				if !o.State.Final() {
+					t.setState(o, o.progress())
+				}
+			case e.OrderUpdate != nil:
+				o, ok := t.orders[e.OrderUpdate.OrderNumber]
+				if !ok || o.State.Final() || toRat(e.OrderUpdate.Amount).Sign() > 0 {
+					continue
+				}
+				// the order left the book, a move shows up as a cancel before Move returns
+				if _, moving := t.moving[o.OrderNumber]; moving && e.OrderUpdate.Reason == "c" {
+					t.moving[o.OrderNumber] = true
+				} else if e.OrderUpdate.Reason == "c" {
+					t.setState(o, OrderCancelled)
+				} else {
+					t.setState(o, OrderFilled)
+				}
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// deliver sends the queued events over C without holding up the tracker on slow readers
+func (t *OrderTracker) deliver() {
+	defer t.wg.Done()
+	for {
+		t.mu.Lock()
+		events := t.pending
+		t.pending = nil
+		t.mu.Unlock()
+		for _, e := range events {
+			select {
+			case t.C <- e:
+			case <-t.stop:
+				return
+			}
+		}
+		select {
+		case <-t.wake:
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// setState moves o to state and queues an event if its state or filled amount changed, t.mu is held
+func (t *OrderTracker) setState(o *trackedOrder, state OrderState) {
+	previous := o.State
+	if previous == OrderMoved && state == OrderCancelled {
+		return
+	}
+	filled := o.Filled.String()
+	o.State = state
+	o.Updated = time.Now()
+	if previous == state && o.reported == filled {
+		return
+	}
+	o.reported = filled
+	t.pending = append(t.pending, OrderEvent{Order: o.TrackedOrder, Previous: previous})
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sum adds up the trades of o into Filled and AvgPrice
+func (o *trackedOrder) sum() {
+	amount, total := new(big.Rat), new(big.Rat)
+	for _, f := range o.trades {
+		amount.Add(amount, f.amount)
+		total.Add(total, new(big.Rat).Mul(f.amount, f.rate))
+	}
+	o.Filled = ratDecimal(amount, 8)
+	if amount.Sign() > 0 {
+		o.AvgPrice = ratDecimal(total.Quo(total, amount), 8)
+	}
+}
+
+// progress is the state of an order in the book by its fills
+func (o *trackedOrder) progress() OrderState {
+	filled := toRat(o.Filled)
+	switch {
+	case filled.Cmp(toRat(o.Amount)) >= 0:
+		return OrderFilled
+	case filled.Sign() > 0:
+		return OrderPartiallyFilled
+	}
+	return OrderOpen
+}
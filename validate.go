@@ -0,0 +1,208 @@
+package poloniex
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+)
+
+type (
+	//MarketRule is what the exchange accepts on a market, rates and amounts with at most
+	//PricePrecision and AmountPrecision decimals and orders worth at least MinTotal of the base currency
+	MarketRule struct {
+		PricePrecision  int
+		AmountPrecision int
+		MinTotal        ggm.Decimal
+	}
+
+	//ValidationError is an order rejected by an OrderValidator before it was sent
+	ValidationError struct {
+		Command string
+		Pair    string
+		Reason  string
+	}
+
+	//OrderValidator checks orders against the state of the markets and currencies and the rules of the
+	//markets, so orders the exchange would refuse fail locally. With Round set, rates and amounts with too
+	//many decimals are rounded instead of rejected, amounts and buy rates down and sell rates up.
+	OrderValidator struct {
+		Round  bool
+		MaxAge time.Duration
+
+		markets *Markets
+		mu      sync.Mutex
+		rules   map[string]MarketRule
+		orders  map[int64]string
+	}
+)
+
+// minTotals is the smallest order total Poloniex accepts by base currency, for the bases it lists markets of
+var minTotals = map[string]string{"BTC": "0.0001", "ETH": "0.0001", "XMR": "0.0001", "USDT": "1", "USDC": "1"}
+
+// DefaultMarketRule is the rule of pair unless set otherwise: 8 decimals for rates and amounts and
+// the minimum total of its base currency. Only the minimums of BTC, ETH, XMR, USDT and USDC are known,
+// the rule of a pair of another base has no MinTotal.
+func DefaultMarketRule(pair string) MarketRule {
+	r, _ := defaultMarketRule(pair)
+	return r
+}
+
+// defaultMarketRule is DefaultMarketRule, ok is false when the minimum total of the base isn't known
+func defaultMarketRule(pair string) (r MarketRule, ok bool) {
+	p, _ := ParsePair(pair)
+	r = MarketRule{PricePrecision: 8, AmountPrecision: 8}
+	min, ok := minTotals[p.Base]
+	if ok {
+		r.MinTotal, _ = ggm.NewDecimalFromString(min)
+	}
+	return r, ok
+}
+
+func (e *ValidationError) Error() string {
+	return e.Command + " " + e.Pair + ": " + e.Reason
+}
+
+// NewOrderValidator returns a validator taking the state of markets and currencies from Ticker and Currencies
+// of market, fetched again when older than a minute. One validator can serve the clients of several accounts.
+func NewOrderValidator(market *Poloniex) *OrderValidator {
+	return NewOrderValidatorWithMarkets(NewMarkets(market))
+}
+
+// NewOrderValidatorWithMarkets returns a validator taking the state of markets and currencies from m
+func NewOrderValidatorWithMarkets(m *Markets) *OrderValidator {
+	return &OrderValidator{MaxAge: time.Minute, markets: m, rules: map[string]MarketRule{}, orders: map[int64]string{}}
+}
+
+// UseValidator checks Buy, Sell and Move orders of the client with v before sending them, nil stops checking
+func (p *Poloniex) UseValidator(v *OrderValidator) {
+	p.validator = v
+}
+
+// SetRule replaces the rule of pair
+func (v *OrderValidator) SetRule(pair string, r MarketRule) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rules[pair] = r
+}
+
+// Rule returns the rule of pair
+func (v *OrderValidator) Rule(pair string) MarketRule {
+	r, _ := v.rule(pair)
+	return r
+}
+
+// rule is Rule, ok is false when pair has no rule set and the minimum total of its base isn't known
+func (v *OrderValidator) rule(pair string) (MarketRule, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if r, ok := v.rules[pair]; ok {
+		return r, true
+	}
+	return defaultMarketRule(pair)
+}
+
+// Order checks an order of command "buy" or "sell" and returns its rate and amount, rounded if Round is set.
+// Orders on a market whose minimum total isn't known are rejected until SetRule gives it a rule.
+func (v *OrderValidator) Order(command, pair string, rate, amount ggm.Decimal) (ggm.Decimal, ggm.Decimal, error) {
+	if err := v.markets.fresh(v.MaxAge); err != nil {
+		return rate, amount, errors.Wrap(err, "validating order failed")
+	}
+	if err := v.tradable(command, pair); err != nil {
+		return rate, amount, err
+	}
+	r, ok := v.rule(pair)
+	if !ok {
+		return rate, amount, &ValidationError{command, pair, "minimum total unknown, set a rule for the market"}
+	}
+	rate, err := v.decimals(command, pair, "rate", rate, r.PricePrecision, command == "sell")
+	if err != nil {
+		return rate, amount, err
+	}
+	amount, err = v.decimals(command, pair, "amount", amount, r.AmountPrecision, false)
+	if err != nil {
+		return rate, amount, err
+	}
+	if total := new(big.Rat).Mul(toRat(rate), toRat(amount)); total.Cmp(toRat(r.MinTotal)) < 0 {
+		return rate, amount, &ValidationError{command, pair, fmt.Sprintf("total %s is below the minimum of %s",
+			strings.TrimRight(strings.TrimRight(total.FloatString(16), "0"), "."), r.MinTotal)}
+	}
+	return rate, amount, nil
+}
+
+// Move checks moving an order to rate and returns the rate, rounded if Round is set. The market is only
+// known for orders placed through a client using v, the minimum total isn't checked as the remaining
+// amount of the order isn't known.
+func (v *OrderValidator) Move(orderNumber int64, rate ggm.Decimal) (ggm.Decimal, error) {
+	v.mu.Lock()
+	pair := v.orders[orderNumber]
+	v.mu.Unlock()
+	if pair == "" {
+		return v.decimals("moveOrder", pair, "rate", rate, DefaultMarketRule(pair).PricePrecision, false)
+	}
+	if err := v.markets.fresh(v.MaxAge); err != nil {
+		return rate, errors.Wrap(err, "validating move failed")
+	}
+	if err := v.tradable("moveOrder", pair); err != nil {
+		return rate, err
+	}
+	return v.decimals("moveOrder", pair, "rate", rate, v.Rule(pair).PricePrecision, false)
+}
+
+// placed remembers the market of an order for checking its moves
+func (v *OrderValidator) placed(orderNumber int64, pair string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.orders[orderNumber] = pair
+}
+
+// moved carries the market of an order over to the number it got when moved
+func (v *OrderValidator) moved(from, to int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if pair, ok := v.orders[from]; ok {
+		delete(v.orders, from)
+		v.orders[to] = pair
+	}
+}
+
+// tradable checks that pair is traded and neither it nor its currencies are frozen, disabled or delisted
+func (v *OrderValidator) tradable(command, pair string) error {
+	p, err := ParsePair(pair)
+	if err != nil {
+		return &ValidationError{command, pair, err.Error()}
+	}
+	m, ok := v.markets.Market(p)
+	if !ok {
+		return &ValidationError{command, pair, "unknown market"}
+	}
+	if reason := m.Inactive(); reason != "" {
+		return &ValidationError{command, pair, reason}
+	}
+	return nil
+}
+
+// decimals checks that d is positive with at most precision decimals, or rounds it to precision if Round is set
+func (v *OrderValidator) decimals(command, pair, field string, d ggm.Decimal, precision int, up bool) (ggm.Decimal, error) {
+	exact := toRat(d)
+	if exact.Sign() <= 0 {
+		return d, &ValidationError{command, pair, field + " must be positive"}
+	}
+	s := d.String()
+	i := strings.IndexByte(s, '.')
+	if i < 0 || len(strings.TrimRight(s[i+1:], "0")) <= precision {
+		return d, nil
+	}
+	if !v.Round {
+		return d, &ValidationError{command, pair, fmt.Sprintf("%s %s has more than %d decimals", field, s, precision)}
+	}
+	rounded := truncRat(exact, precision, up)
+	if rounded.Sign() <= 0 {
+		return d, &ValidationError{command, pair, fmt.Sprintf("%s %s rounds to 0", field, s)}
+	}
+	return ratDecimal(rounded, precision), nil
+}
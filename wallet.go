@@ -0,0 +1,151 @@
+package poloniex
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hhh0pE/ggm"
+	"github.com/pkg/errors"
+)
+
+type (
+	//WithdrawalGuard checks withdrawals before they are signed. With Addresses set, a currency may only be
+	//withdrawn to the addresses listed for it, currencies missing from it not at all. MaxAmount caps a single
+	//withdrawal and DailyLimit the withdrawals through the guard in 24 hours, per currency, none if missing.
+	WithdrawalGuard struct {
+		Addresses  map[string][]WhitelistedAddress
+		MaxAmount  map[string]ggm.Decimal
+		DailyLimit map[string]ggm.Decimal
+
+		mu   sync.Mutex
+		sent []*guardedWithdrawal
+	}
+
+	//WhitelistedAddress is an address a WithdrawalGuard lets withdrawals go to. For currencies needing a
+	//payment ID besides the address, e.g. a memo or destination tag, only withdrawals with this PaymentID
+	//are let through, for the others PaymentID is empty.
+	WhitelistedAddress struct {
+		Address   string
+		PaymentID string
+	}
+
+	//WithdrawalError is a withdrawal refused by a WithdrawalGuard before it was sent
+	WithdrawalError struct {
+		Currency string
+		Address  string
+		Reason   string
+	}
+
+	guardedWithdrawal struct {
+		currency string
+		amount   *big.Rat
+		at       time.Time
+	}
+)
+
+func (e *WithdrawalError) Error() string {
+	return "withdraw " + e.Currency + " to " + e.Address + ": " + e.Reason
+}
+
+// UseWithdrawalGuard checks withdrawals of the client with g before signing them, nil stops checking
+func (p *Poloniex) UseWithdrawalGuard(g *WithdrawalGuard) {
+	p.guard = g
+}
+
+// check refuses a withdrawal breaking the rules of g, an allowed one counts towards the daily limit
+func (g *WithdrawalGuard) check(currency string, amount ggm.Decimal, address, paymentID string) (*guardedWithdrawal, error) {
+	refuse := func(reason string) (*guardedWithdrawal, error) {
+		return nil, &WithdrawalError{currency, address, reason}
+	}
+	a := toRat(amount)
+	if a.Sign() <= 0 {
+		return refuse("amount must be positive")
+	}
+	if g.Addresses != nil && !contains(g.Addresses[currency], WhitelistedAddress{address, paymentID}) {
+		return refuse("address and payment ID are not whitelisted")
+	}
+	if max, ok := g.MaxAmount[currency]; ok && a.Cmp(toRat(max)) > 0 {
+		return refuse("amount is above the maximum of " + max.String())
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	kept := g.sent[:0]
+	total := new(big.Rat).Set(a)
+	for _, s := range g.sent {
+		if now.Sub(s.at) >= 24*time.Hour {
+			continue
+		}
+		kept = append(kept, s)
+		if s.currency == currency {
+			total.Add(total, s.amount)
+		}
+	}
+	g.sent = kept
+	if limit, ok := g.DailyLimit[currency]; ok && total.Cmp(toRat(limit)) > 0 {
+		return refuse("withdrawals would exceed the daily limit of " + limit.String())
+	}
+	s := &guardedWithdrawal{currency: currency, amount: a, at: now}
+	g.sent = append(g.sent, s)
+	return s, nil
+}
+
+// failed takes back a withdrawal the exchange refused or that was never sent from the daily limit
+func (g *WithdrawalGuard) failed(s *guardedWithdrawal) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, v := range g.sent {
+		if v == s {
+			g.sent = append(g.sent[:i], g.sent[i+1:]...)
+			return
+		}
+	}
+}
+
+func contains(list []WhitelistedAddress, a WhitelistedAddress) bool {
+	for _, v := range list {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+// withdrawalNumber looks up the number of a withdrawal sent after start in the history. It has to be the
+// only withdrawal of currency, amount and address there whose number wasn't handed out before, identical
+// withdrawals sent at the same time can't be told apart.
+func (p *Poloniex) withdrawalNumber(ctx context.Context, currency string, amount ggm.Decimal, address string, start time.Time) (int64, error) {
+	// the history has timestamps in seconds
+	dw, err := p.depositsWithdrawalsRange(ctx, start.Add(-time.Minute), time.Now().Add(time.Minute))
+	if err != nil {
+		return 0, errors.Wrap(err, "looking up the withdrawal number failed")
+	}
+	p.claimMutex.Lock()
+	defer p.claimMutex.Unlock()
+	if p.claimed == nil {
+		p.claimed = map[int64]time.Time{}
+	}
+	for n, at := range p.claimed {
+		// far out of the range of any lookup still running
+		if time.Since(at) > time.Hour {
+			delete(p.claimed, n)
+		}
+	}
+	found := []int64{}
+	for _, w := range dw.Withdrawals {
+		if w.Currency == currency && w.Address == address && toRat(w.Amount).Cmp(toRat(amount)) == 0 && p.claimed[w.WithdrawalNumber].IsZero() {
+			found = append(found, w.WithdrawalNumber)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return 0, errors.New("withdrawal not found in the history")
+	case 1:
+		p.claimed[found[0]] = time.Now()
+		return found[0], nil
+	}
+	return 0, errors.Errorf("withdrawal number ambiguous, %d identical withdrawals in the history", len(found))
+}
@@ -1,12 +1,13 @@
 package poloniex
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"sync"
 	"time"
 
 	"github.com/hhh0pE/ggm"
-	"github.com/k0kubun/pp"
+	"github.com/pkg/errors"
 	"gopkg.in/beatgammit/turnpike.v2"
 )
 
@@ -51,108 +52,459 @@ type (
 
 	// WSOrderOrTradeChan is a onduit through which WSTicker items are sent
 	WSOrderOrTradeChan chan WSOrderOrTrade
+
+	//Subscription is one subscriber of a websocket topic, several subscriptions may share a topic.
+	//Every subscription has its own queue, so a slow reader doesn't hold up the others. A reader falling
+	//more than subscriptionQueue updates behind loses the oldest ones, readers of the order feed see
+	//that as a skipped Seq.
+	Subscription struct {
+		Topic   string
+		p       *Poloniex
+		mu      sync.Mutex
+		once    sync.Once
+		done    chan struct{}
+		pumped  chan struct{}
+		wake    chan struct{}
+		queue   []interface{}
+		dropped int64
+		closed  bool
+		send    func(v interface{}, done chan struct{})
+		closeC  func()
+	}
+
+	//TickerSubscription delivers ticker updates over C until closed
+	TickerSubscription struct {
+		*Subscription
+		C WSTickerChan
+	}
+
+	//OrderSubscription delivers order and trade updates of a pair over C until closed
+	OrderSubscription struct {
+		*Subscription
+		C WSOrderOrTradeChan
+	}
+
+	wsTopic struct {
+		// feed is the connection the topic is on, "wamp" or "push"
+		feed        string
+		subs        []*Subscription
+		subscribe   func() error
+		unsubscribe func() error
+	}
 )
 
 const (
 	//SENTINEL is used to mark items without a sequence number
 	SENTINEL = int64(-1)
+
+	// subscriptionQueue is how many updates a subscription holds for its reader
+	subscriptionQueue = 1024
 )
 
+//NewTickerSubscription adds an independent subscriber to the ticker feed, updates are sent over its C
+func (p *Poloniex) NewTickerSubscription() (*TickerSubscription, error) {
+	return p.newTickerSubscription(context.Background())
+}
+
+//newTickerSubscription is NewTickerSubscription giving up connecting when ctx is done
+func (p *Poloniex) newTickerSubscription(ctx context.Context) (*TickerSubscription, error) {
+	ch := make(WSTickerChan)
+	s := p.newSubscription("ticker", func(v interface{}, done chan struct{}) {
+		select {
+		case ch <- v.(WSTicker):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	t, err := p.wampTopic(ctx, "ticker", p.makeTickerHandler("ticker"))
+	if err != nil {
+		s.discard()
+		return nil, err
+	}
+	if err := p.addSubscription(s, t); err != nil {
+		s.discard()
+		return nil, err
+	}
+	return &TickerSubscription{Subscription: s, C: ch}, nil
+}
+
+//NewOrderSubscription adds an independent subscriber to the order and trade feed of a pair, updates are sent over its C
+func (p *Poloniex) NewOrderSubscription(code string) (*OrderSubscription, error) {
+	ch := make(WSOrderOrTradeChan)
+	s := p.newSubscription(code, func(v interface{}, done chan struct{}) {
+		select {
+		case ch <- v.(WSOrderOrTrade):
+		case <-done:
+		}
+	}, func() { close(ch) })
+	t, err := p.wampTopic(context.Background(), code, p.makeOrderHandler(code))
+	if err != nil {
+		s.discard()
+		return nil, err
+	}
+	if err := p.addSubscription(s, t); err != nil {
+		s.discard()
+		return nil, err
+	}
+	return &OrderSubscription{Subscription: s, C: ch}, nil
+}
+
 //SubscribeTicker subscribes to the ticker feed and returns a channel over which it will send updates
 func (p *Poloniex) SubscribeTicker() WSTickerChan {
-	p.InitWS()
-	p.subscribedTo["ticker"] = true
-	ch := make(WSTickerChan)
-	p.ws.Subscribe("ticker", p.makeTickerHandler(ch))
-	return ch
+	s, err := p.NewTickerSubscription()
+	if err != nil {
+		p.log().Error("subscribing failed", "topic", "ticker", "error", err)
+		return make(WSTickerChan)
+	}
+	p.keepLegacy(s.Subscription)
+	return s.C
 }
 
 //SubscribeOrder subscribes to the order and trade feed and returns a channel over which it will send updates
 func (p *Poloniex) SubscribeOrder(code string) WSOrderOrTradeChan {
-	p.InitWS()
-	p.subscribedTo[code] = true
-	ch := make(WSOrderOrTradeChan)
-	p.ws.Subscribe(code, p.makeOrderHandler(code, ch))
-	return ch
+	s, err := p.NewOrderSubscription(code)
+	if err != nil {
+		p.log().Error("subscribing failed", "topic", code, "error", err)
+		return make(WSOrderOrTradeChan)
+	}
+	p.keepLegacy(s.Subscription)
+	return s.C
 }
 
 //UnsubscribeTicker ... I think you can guess
 func (p *Poloniex) UnsubscribeTicker() {
-	p.InitWS()
 	p.Unsubscribe("ticker")
 }
 
 //UnsubscribeOrder ... I think you can guess
 func (p *Poloniex) UnsubscribeOrder(code string) {
-	p.InitWS()
 	p.Unsubscribe(code)
 }
 
-//Unsubscribe from the relevant feed
+//Unsubscribe closes the channels handed out by SubscribeTicker/SubscribeOrder for the relevant feed,
+//subscriptions made with NewTickerSubscription/NewOrderSubscription are left alone
 func (p *Poloniex) Unsubscribe(code string) {
-	p.InitWS()
-	if p.isSubscribed(code) {
-		delete(p.subscribedTo, code)
-		p.ws.Unsubscribe(code)
+	p.wsMutex.Lock()
+	subs := p.legacy[code]
+	delete(p.legacy, code)
+	p.wsMutex.Unlock()
+	for _, s := range subs {
+		if err := s.Close(); err != nil {
+			p.log().Warn("closing subscription failed", "topic", code, "error", err)
+		}
+	}
+}
+
+//Close unsubscribes everything, closes the websocket connections and closes every channel handed out,
+//so loops ranging over them terminate
+func (p *Poloniex) Close() error {
+	return p.Shutdown(context.Background())
+}
+
+//Shutdown is Close bounded by ctx, if ctx expires first its error is returned and closing carries on in the background
+func (p *Poloniex) Shutdown(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- p.closeWS()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Poloniex) closeWS() (err error) {
+	p.wsMutex.Lock()
+	subs := []*Subscription{}
+	for _, t := range p.topics {
+		subs = append(subs, t.subs...)
+	}
+	if p.heartbeat != nil {
+		close(p.heartbeat)
+		p.heartbeat = nil
+	}
+	p.legacy = nil
+	p.wsMutex.Unlock()
+
+	for _, s := range subs {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.ws != nil {
+		if e := p.ws.Close(); e != nil && err == nil {
+			err = errors.Wrap(e, "closing websocket connection failed")
+		}
+		p.ws = nil
+	}
+	if p.push != nil {
+		c := p.push
+		p.push = nil
+		if e := c.Close(); e != nil && err == nil {
+			err = errors.Wrap(e, "closing websocket connection to "+p.pushURI()+" failed")
+		}
+	}
+	return
+}
+
+//Close stops delivery to this subscriber and closes its channel, the topic is
+//unsubscribed once its last subscriber is closed. Updates still queued are discarded.
+func (s *Subscription) Close() error {
+	s.once.Do(func() { close(s.done) })
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.queue = nil
+	s.mu.Unlock()
+	<-s.pumped
+	s.closeC()
+	return s.p.removeSubscription(s)
+}
+
+//discard stops the pump of a subscription that never got registered
+func (s *Subscription) discard() {
+	s.once.Do(func() { close(s.done) })
+}
+
+//Dropped is how many updates the subscriber lost by falling too far behind
+func (s *Subscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+//deliver queues a parsed update for the subscriber, dropping the oldest one if the queue is full
+func (s *Subscription) deliver(v interface{}) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	if len(s.queue) >= subscriptionQueue {
+		s.queue = s.queue[1:]
+		s.dropped++
+		if s.dropped == 1 || s.dropped%subscriptionQueue == 0 {
+			s.p.log().Warn("subscriber falling behind, dropping updates", "topic", s.Topic, "dropped", s.dropped)
+		}
+	}
+	s.queue = append(s.queue, v)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+//pump sends the queued updates over the channel of the subscriber until it is closed
+func (s *Subscription) pump() {
+	defer close(s.pumped)
+	for {
+		s.mu.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mu.Unlock()
+		for _, v := range queue {
+			s.send(v, s.done)
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+		}
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (p *Poloniex) newSubscription(topic string, send func(interface{}, chan struct{}), closeC func()) *Subscription {
+	s := &Subscription{
+		Topic:  topic,
+		p:      p,
+		done:   make(chan struct{}),
+		pumped: make(chan struct{}),
+		wake:   make(chan struct{}, 1),
+		send:   send,
+		closeC: closeC,
+	}
+	go s.pump()
+	return s
+}
+
+//wampTopic describes how to subscribe to and unsubscribe from a feed of the WAMP websocket,
+//connecting it first until ctx is done
+func (p *Poloniex) wampTopic(ctx context.Context, topic string, handler turnpike.EventHandler) (*wsTopic, error) {
+	if p.cassetteMode == cassetteReplay {
+		// PlayFrames feeds the handler, nothing is sent anywhere
+		return &wsTopic{
+			subscribe: func() error {
+				if p.replayTopics == nil {
+					p.replayTopics = map[string]turnpike.EventHandler{}
+				}
+				p.replayTopics[topic] = handler
+				return nil
+			},
+			unsubscribe: func() error {
+				delete(p.replayTopics, topic)
+				return nil
+			},
+		}, nil
+	}
+	handler = p.recordingHandler(topic, handler)
+	if err := p.Connect(ctx); err != nil {
+		return nil, err
+	}
+	// both run with wsMutex held, p.ws is nil once the client was closed after connecting
+	return &wsTopic{
+		feed: "wamp",
+		subscribe: func() error {
+			if p.ws == nil {
+				return errors.New("websocket closed")
+			}
+			return p.ws.Subscribe(topic, handler)
+		},
+		unsubscribe: func() error {
+			if p.ws == nil {
+				return nil
+			}
+			return p.ws.Unsubscribe(topic)
+		},
+	}, nil
+}
+
+//addSubscription registers s on its topic, subscribing to the feed described by t if s is the first one
+func (p *Poloniex) addSubscription(s *Subscription, t *wsTopic) error {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	if p.topics == nil {
+		p.topics = map[string]*wsTopic{}
+	}
+	if existing, ok := p.topics[s.Topic]; ok {
+		t = existing
+	} else {
+		if err := t.subscribe(); err != nil {
+			return errors.Wrap(err, "subscribing to "+s.Topic+" failed")
+		}
+		p.topics[s.Topic] = t
+	}
+	t.subs = append(t.subs, s)
+	return nil
+}
+
+//removeSubscription drops s from its topic, unsubscribing from the feed if s was the last one
+func (p *Poloniex) removeSubscription(s *Subscription) error {
+	p.wsMutex.Lock()
+	defer p.wsMutex.Unlock()
+	t, ok := p.topics[s.Topic]
+	if !ok {
+		return nil
+	}
+	for i := range t.subs {
+		if t.subs[i] == s {
+			t.subs = append(t.subs[:i], t.subs[i+1:]...)
+			break
+		}
+	}
+	if len(t.subs) > 0 {
+		return nil
+	}
+	delete(p.topics, s.Topic)
+	if err := t.unsubscribe(); err != nil {
+		return errors.Wrap(err, "unsubscribing from "+s.Topic+" failed")
+	}
+	return nil
+}
+
+func (p *Poloniex) keepLegacy(s *Subscription) {
+	p.wsMutex.Lock()
+	if p.legacy == nil {
+		p.legacy = map[string][]*Subscription{}
+	}
+	p.legacy[s.Topic] = append(p.legacy[s.Topic], s)
+	p.wsMutex.Unlock()
+}
+
+//publish fans a parsed update out to every subscriber of topic
+func (p *Poloniex) publish(topic string, v interface{}) {
+	p.wsMutex.Lock()
+	t, ok := p.topics[topic]
+	var subs []*Subscription
+	if ok {
+		subs = append(subs, t.subs...)
+	}
+	p.wsMutex.Unlock()
+	p.measure().ObserveMessage(topic, messageLag(v))
+	for _, s := range subs {
+		s.deliver(v)
 	}
 }
 
-//makeTickerHandler takes a WS Order or Trade and send it over the channel sepcified by the user
-func (p *Poloniex) makeTickerHandler(ch chan WSTicker) turnpike.EventHandler {
+//makeTickerHandler takes a WS Order or Trade and publishes it to the subscribers of topic
+func (p *Poloniex) makeTickerHandler(topic string) turnpike.EventHandler {
+	publish, logger := p.publish, p.log
 	return func(p []interface{}, n map[string]interface{}) {
 		var t WSTicker
 
 		t.Pair = p[0].(string)
 		if parsed, err := ggm.ParseDecimal(p[1]); err != nil {
-			log.Println("ws ticker parse Last error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "Last", "error", err)
 		} else {
 			t.Last = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[2]); err != nil {
-			log.Println("ws ticker parse Ask error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "Ask", "error", err)
 		} else {
 			t.Ask = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[3]); err != nil {
-			log.Println("ws ticker parse Bid error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "Bid", "error", err)
 		} else {
 			t.Bid = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[4]); err != nil {
-			log.Println("ws ticker parse PercentChange error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "PercentChange", "error", err)
 		} else {
-			t.Last = parsed.MultiplyFloat(100)
+			t.PercentChange = parsed.MultiplyFloat(100)
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[5]); err != nil {
-			log.Println("ws ticker parse BaseVolume error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "BaseVolume", "error", err)
 		} else {
 			t.BaseVolume = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[6]); err != nil {
-			log.Println("ws ticker parse Quote Volume error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "Quote Volume", "error", err)
 		} else {
 			t.QuoteVolume = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[7]); err != nil {
-			log.Println("ws ticker parse IsFrozen error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "IsFrozen", "error", err)
 		} else {
 			t.IsFrozen = !parsed.EqualFloat(0.0)
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[8]); err != nil {
-			log.Println("ws ticker parse Daily High error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "Daily High", "error", err)
 		} else {
 			t.DailyHigh = parsed
 		}
 
 		if parsed, err := ggm.ParseDecimal(p[9]); err != nil {
-			log.Println("ws ticker parse Daily Low error: " + err.Error())
+			logger().Warn("ws ticker parse error", "field", "Daily Low", "error", err)
 		} else {
 			t.DailyLow = parsed
 		}
@@ -169,12 +521,13 @@ func (p *Poloniex) makeTickerHandler(ch chan WSTicker) turnpike.EventHandler {
 		//	DailyHigh:     f(p[8]),
 		//	DailyLow:      f(p[9]),
 		//}
-		ch <- t
+		publish(topic, t)
 	}
 }
 
-//makeOrderHandler takes a WS Order or Trade and send it over the channel sepcified by the user
-func (p *Poloniex) makeOrderHandler(coin string, ch WSOrderOrTradeChan) turnpike.EventHandler {
+//makeOrderHandler takes a WS Order or Trade and publishes it to the subscribers of coin
+func (p *Poloniex) makeOrderHandler(coin string) turnpike.EventHandler {
+	publish, logger := p.publish, p.log
 	return func(p []interface{}, n map[string]interface{}) {
 		seq := int64(SENTINEL)
 		if s, ok := n["seq"]; ok {
@@ -182,28 +535,27 @@ func (p *Poloniex) makeOrderHandler(coin string, ch WSOrderOrTradeChan) turnpike
 		}
 		b, err := json.Marshal(p)
 		if err != nil {
-			log.Println(err)
+			logger().Warn("ws order parse error", "topic", coin, "error", err)
 			return
 		}
 		oot := WSOrders{}
 		err = json.Unmarshal(b, &oot)
 		if err != nil {
-			log.Println(err)
+			logger().Warn("ws order parse error", "topic", coin, "error", err)
 			return
 		}
 		ootTmp := WSOrders{}
 		for _, o := range oot {
 			if o.Type == "newTrade" {
-				pp.Println("Date:", o.Data.Date)
 				d, err := time.Parse("2006-01-02 15:04:05", o.Data.Date)
 				if err != nil {
-					log.Println(err)
+					logger().Warn("ws trade date parse error", "topic", coin, "date", o.Data.Date, "error", err)
 				}
 				o.Data.TS = d
 			}
 			ootTmp = append(ootTmp, o)
 		}
 		o := WSOrderOrTrade{Seq: seq, Orders: ootTmp}
-		ch <- o
+		publish(coin, o)
 	}
 }